@@ -1055,7 +1055,11 @@ func (a *App) visitStatesWithSelectorsAndRemoteSupport(fileOrDir string, converg
 		opts.Environment.OverrideValues = envvals
 	}
 
-	a.remote = remote.NewRemote(a.Logger, "", a.fs)
+	r, err := remote.NewRemote(a.Logger, "", a.fs)
+	if err != nil {
+		return err
+	}
+	a.remote = r
 
 	f := converge
 	if opts.Filter {
@@ -2171,6 +2175,9 @@ func (a *App) ShowCacheDir(c CacheConfigProvider) error {
 		return err
 	}
 	for _, e := range dirs {
+		if remote.IsCacheSidecar(e.Name()) {
+			continue
+		}
 		fmt.Printf("- %s\n", e.Name())
 	}
 
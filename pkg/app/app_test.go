@@ -1489,7 +1489,9 @@ helmDefaults:
 		Env:                 "default",
 		Logger:              newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, "", app.fs)
+	r, err := remote.NewRemote(app.Logger, "", app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1569,7 +1571,9 @@ helmDefaults:
 		Env:                "default",
 		Logger:             newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1641,7 +1645,9 @@ foo: FOO
 		Env:                "default",
 		Logger:             newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1699,7 +1705,9 @@ foo: FOO
 		Env:                "default",
 		Logger:             newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1775,7 +1783,9 @@ helmDefaults:
 		Env:                "test",
 		Logger:             newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1844,7 +1854,9 @@ releases:
 		Env:                "default",
 		Logger:             newAppTestLogger(),
 	}
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 
 	expectNoCallsToHelm(app)
 
@@ -1901,7 +1913,9 @@ releases:
 		Logger:             newAppTestLogger(),
 	}
 
-	app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+	assert.NoError(t, err)
+	app.remote = r
 	expectNoCallsToHelm(app)
 
 	st, err := app.loadDesiredStateFromYaml(statePath, LoadOpts{Reverse: true})
@@ -1955,7 +1969,9 @@ releases:
 			Env:                "default",
 			Logger:             newAppTestLogger(),
 		}
-		app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+		r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+		assert.NoError(t, err)
+		app.remote = r
 
 		opts := LoadOpts{
 			CalleePath: statePath,
@@ -2067,7 +2083,9 @@ services:
 			Env:                "default",
 			Logger:             newAppTestLogger(),
 		}
-		app.remote = remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+		r, err := remote.NewRemote(app.Logger, testFs.Cwd, app.fs)
+		assert.NoError(t, err)
+		app.remote = r
 
 		expectNoCallsToHelm(app)
 
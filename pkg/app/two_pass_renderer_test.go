@@ -17,7 +17,10 @@ import (
 func makeLoader(files map[string]string, env string) (*desiredStateLoader, *testhelper.TestFs, *bytes.Buffer) {
 	testfs := testhelper.NewTestFs(files)
 	logger := newAppTestLogger()
-	r := remote.NewRemote(logger, testfs.Cwd, testfs.ToFileSystem())
+	r, err := remote.NewRemote(logger, testfs.Cwd, testfs.ToFileSystem())
+	if err != nil {
+		panic(err)
+	}
 	var buf bytes.Buffer
 	loaderLogger := helmexec.NewLogger(&buf, "debug")
 	return &desiredStateLoader{
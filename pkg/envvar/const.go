@@ -11,4 +11,26 @@ const (
 	V1Mode                        = "HELMFILE_V1MODE"
 	GoccyGoYaml                   = "HELMFILE_GOCCY_GOYAML"
 	CacheHome                     = "HELMFILE_CACHE_HOME"
+	CacheMaxAge                   = "HELMFILE_CACHE_MAX_AGE"
+	CacheWarnAge                  = "HELMFILE_CACHE_WARN_AGE"
+	CacheMaxBytes                 = "HELMFILE_CACHE_MAX_BYTES"
+	CacheContentAddressed         = "HELMFILE_CACHE_CONTENT_ADDRESSED"
+	CacheStoreDir                 = "HELMFILE_CACHE_STORE_DIR"
+	CacheNamespace                = "HELMFILE_CACHE_NAMESPACE"
+	RemoteOffline                 = "HELMFILE_REMOTE_OFFLINE"
+	RemoteStrictEnv               = "HELMFILE_REMOTE_STRICT_ENV"
+	RemoteKeepFailedDownloads     = "HELMFILE_REMOTE_KEEP_FAILED_DOWNLOADS"
+	FetchConcurrency              = "HELMFILE_FETCH_CONCURRENCY"
+	FetchTimeout                  = "HELMFILE_FETCH_TIMEOUT"
+	FetchRPS                      = "HELMFILE_FETCH_RPS"
+	ConnectRetries                = "HELMFILE_REMOTE_CONNECT_RETRIES"
+	ConnectRetryDelay             = "HELMFILE_REMOTE_CONNECT_RETRY_DELAY"
+	InsecureAllowList             = "HELMFILE_INSECURE_ALLOW_LIST"
+	RemoteAllowedHosts            = "HELMFILE_REMOTE_ALLOWED_HOSTS"
+	RemoteUserAgent               = "HELMFILE_REMOTE_USER_AGENT"
+	RemoteHTTPListing             = "HELMFILE_REMOTE_HTTP_LISTING"
+	HTTPBearerToken               = "HELMFILE_HTTP_BEARER_TOKEN"
+	HTTPTimeout                   = "HELMFILE_HTTP_TIMEOUT"
+	S3Endpoint                    = "HELMFILE_S3_ENDPOINT"
+	S3ForcePathStyle              = "HELMFILE_S3_FORCE_PATH_STYLE"
 )
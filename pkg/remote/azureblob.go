@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/hashicorp/go-getter/helper/url"
+	"go.uber.org/zap"
+)
+
+const azureStorageConnectionString = "AZURE_STORAGE_CONNECTION_STRING"
+
+// AzureBlobGetter downloads all the blobs under a container prefix from Azure Blob Storage.
+// The source must be of the form az://<account>/<container>/<path/to/dir> (or azblob://...).
+type AzureBlobGetter struct {
+	Logger *zap.SugaredLogger
+}
+
+func (g *AzureBlobGetter) Get(ctx context.Context, wd, src, dst string) error {
+	account, container, prefix, err := ParseAzureBlobURL(src)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAzureBlobClient(account)
+	if err != nil {
+		return fmt.Errorf("creating azure blob client: %w", err)
+	}
+
+	// List with a trailing slash so that e.g. `dir` doesn't match blobs under `dir-other/`
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var blobs []string
+	pager := client.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return azureBlobError(fmt.Errorf("listing blobs in %s/%s: %w", container, prefix, err))
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				blobs = append(blobs, *item.Name)
+			}
+		}
+	}
+
+	if len(blobs) == 0 {
+		return RemoteNotFoundError{err: fmt.Errorf("no blobs found under azblob://%s/%s/%s", account, container, prefix)}
+	}
+
+	for _, blob := range blobs {
+		localPath := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(blob, prefix)))
+		if !strings.HasPrefix(localPath, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("blob %s/%s would be written outside of %s", container, blob, dst)
+		}
+
+		loggerOrNop(g.Logger).Debugf("azureblob> downloading %s/%s to %s", container, blob, localPath)
+
+		if err := downloadAzureBlob(ctx, client, container, blob, localPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func downloadAzureBlob(ctx context.Context, client *azblob.Client, container, blob, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := client.DownloadFile(ctx, container, blob, f, nil); err != nil {
+		return azureBlobError(fmt.Errorf("downloading blob %s/%s: %w", container, blob, err))
+	}
+
+	return nil
+}
+
+// azureBlobError types err from the status code of the response that caused it, if any
+func azureBlobError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	return errorForStatus(respErr.StatusCode, err)
+}
+
+// newAzureBlobClient authenticates with AZURE_STORAGE_CONNECTION_STRING when it is set,
+// and falls back to the default Azure credential chain against the account's blob endpoint otherwise.
+func newAzureBlobClient(account string) (*azblob.Client, error) {
+	if connStr := os.Getenv(azureStorageConnectionString); connStr != "" {
+		return azblob.NewClientFromConnectionString(connStr, nil)
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return azblob.NewClient(fmt.Sprintf("https://%s.blob.core.windows.net/", account), cred, nil)
+}
+
+// ParseAzureBlobURL splits az://<account>/<container>/<prefix> into its components.
+func ParseAzureBlobURL(src string) (account, container, prefix string, err error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", "", "", fmt.Errorf("parse url: %w", err)
+	}
+
+	if u.Scheme != "az" && u.Scheme != "azblob" {
+		return "", "", "", fmt.Errorf("unsupported azure blob scheme %q: it must be az or azblob", u.Scheme)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if u.Host == "" || parts[0] == "" {
+		return "", "", "", fmt.Errorf("invalid azure blob url: it must be `az://<account>/<container>/<path/to/dir>`: got %s", src)
+	}
+
+	account = u.Host
+	container = parts[0]
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+
+	return account, container, prefix, nil
+}
@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/helmfile/helmfile/pkg/helmexec"
+	"github.com/helmfile/helmfile/pkg/testhelper"
+)
+
+func TestParseAzureBlobURL(t *testing.T) {
+	type testcase struct {
+		input                      string
+		account, container, prefix string
+		err                        string
+	}
+
+	testcases := []testcase{
+		{
+			input:     "az://myaccount/helmfiles/shared/values",
+			account:   "myaccount",
+			container: "helmfiles",
+			prefix:    "shared/values",
+		},
+		{
+			input:     "azblob://myaccount/helmfiles",
+			account:   "myaccount",
+			container: "helmfiles",
+		},
+		{
+			input: "az://myaccount",
+			err:   "invalid azure blob url: it must be `az://<account>/<container>/<path/to/dir>`: got az://myaccount",
+		},
+		{
+			input: "s3://mybucket/helmfiles",
+			err:   `unsupported azure blob scheme "s3": it must be az or azblob`,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(fmt.Sprintf("case %d", i), func(t *testing.T) {
+			account, container, prefix, err := ParseAzureBlobURL(tc.input)
+
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+
+			if diff := cmp.Diff(tc.err, errMsg); diff != "" {
+				t.Fatalf("Unexpected error:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.account, account); diff != "" {
+				t.Fatalf("Unexpected account:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.container, container); diff != "" {
+				t.Fatalf("Unexpected container:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.prefix, prefix); diff != "" {
+				t.Fatalf("Unexpected prefix:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemote_AzureBlob(t *testing.T) {
+	testfs := testhelper.NewTestFs(map[string]string{
+		CacheDir(): "",
+	})
+
+	get := func(wd, src, dst string) error {
+		return fmt.Errorf("unexpected call to go-getter with src: %s", src)
+	}
+
+	var downloaded string
+	azGet := func(wd, src, dst string) error {
+		downloaded = src
+		return nil
+	}
+
+	remote := &Remote{
+		Logger: helmexec.NewLogger(io.Discard, "debug"),
+		Home:   CacheDir(),
+		Getter: &testGetter{get: get},
+		fs:     testfs.ToFileSystem(),
+	}
+
+	remote.RegisterGetter("az", &testGetter{get: azGet})
+
+	file, err := remote.Fetch("az://myaccount/helmfiles/shared@values.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if downloaded != "az://myaccount/helmfiles/shared" {
+		t.Errorf("unexpected src: %s", downloaded)
+	}
+
+	expectedFile := filepath.Join(CacheDir(), "az_myaccount_helmfiles_shared-4d4de914ea9b/values.yaml")
+	if file != expectedFile {
+		t.Errorf("unexpected file located: %s vs expected: %s", file, expectedFile)
+	}
+}
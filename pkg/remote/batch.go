@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+// defaultFetchConcurrency is the number of remote directories FetchAll downloads at once when FetchConcurrency is unset
+const defaultFetchConcurrency = 4
+
+// FetchAll fetches the remote files concurrently and returns the path to each of them in the fetched directories, keyed by source.
+// Sources that share a cache entry, e.g. two files in the same git repository, are fetched one after the other so that the
+// directory is downloaded only once. The errors of all the failed fetches are combined into the returned error.
+func (r *Remote) FetchAll(goGetterSrcs []string, cacheDirOpt ...string) (map[string]string, error) {
+	return r.FetchAllContext(context.Background(), goGetterSrcs, cacheDirOpt...)
+}
+
+// FetchAllContext is like FetchAll, but passes ctx down to the getters so that the downloads can be cancelled
+func (r *Remote) FetchAllContext(ctx context.Context, goGetterSrcs []string, cacheDirOpt ...string) (map[string]string, error) {
+	var (
+		errs   error
+		groups = map[string][]string{}
+		keys   []string
+		seen   = map[string]bool{}
+	)
+
+	for _, src := range goGetterSrcs {
+		if seen[src] {
+			continue
+		}
+		seen[src] = true
+
+		t, err := r.resolve(src, cacheDirOpt)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("fetching %s: %w", src, err))
+			continue
+		}
+
+		if _, ok := groups[t.getterDst]; !ok {
+			keys = append(keys, t.getterDst)
+		}
+		groups[t.getterDst] = append(groups[t.getterDst], src)
+	}
+
+	concurrency := r.FetchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultFetchConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		fetched = map[string]string{}
+		sem     = make(chan struct{}, concurrency)
+	)
+
+	for _, key := range keys {
+		srcs := groups[key]
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			for _, src := range srcs {
+				path, err := r.FetchContext(ctx, src, cacheDirOpt...)
+
+				mu.Lock()
+				if err != nil {
+					errs = multierr.Append(errs, fmt.Errorf("fetching %s: %w", src, err))
+				} else {
+					fetched[src] = path
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return fetched, errs
+}
+
+// Prefetch populates the cache with the remote files, like FetchAll, e.g. in a connected environment before the cache
+// is copied to an air-gapped one and used in offline mode. The errors of all the failed fetches are combined into the returned error.
+func (r *Remote) Prefetch(goGetterSrcs []string, cacheDirOpt ...string) error {
+	if r.NoCache {
+		return fmt.Errorf("unable to prefetch %d remote files: the cache is disabled", len(goGetterSrcs))
+	}
+
+	_, err := r.FetchAll(goGetterSrcs, cacheDirOpt...)
+	return err
+}
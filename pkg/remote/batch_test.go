@@ -0,0 +1,227 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestRemote_FetchAll(t *testing.T) {
+	home := t.TempDir()
+
+	var (
+		mu             sync.Mutex
+		downloads      = map[string]int{}
+		running        int
+		maxRunning     int
+		expectedMaxRun = 2
+	)
+
+	get := func(wd, src, dst string) error {
+		mu.Lock()
+		downloads[src]++
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		// Give the other downloads a chance to run concurrently
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		for _, f := range []string{"a.yaml", "b.yaml"} {
+			if err := os.WriteFile(filepath.Join(dst, f), []byte("foo: bar"), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	remote := &Remote{
+		Logger:           helmexec.NewLogger(io.Discard, "debug"),
+		Home:             home,
+		FetchConcurrency: expectedMaxRun,
+		Getter:           &testGetter{get: get},
+		fs:               filesystem.DefaultFileSystem(),
+	}
+
+	srcs := []string{
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v1",
+		"git::https://github.com/helmfile/helmfile.git@b.yaml?ref=v1",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v1",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v2",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v3",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v4",
+	}
+
+	fetched, err := remote.FetchAll(srcs, "states")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedFetched := map[string]string{
+		srcs[0]: filepath.Join(home, "states/https_github_com_helmfile_helmfile_git.ref=v1-fd24f90a8384/a.yaml"),
+		srcs[1]: filepath.Join(home, "states/https_github_com_helmfile_helmfile_git.ref=v1-fd24f90a8384/b.yaml"),
+		srcs[3]: filepath.Join(home, "states/https_github_com_helmfile_helmfile_git.ref=v2-33d3aa209b43/a.yaml"),
+		srcs[4]: filepath.Join(home, "states/https_github_com_helmfile_helmfile_git.ref=v3-312d25229d67/a.yaml"),
+		srcs[5]: filepath.Join(home, "states/https_github_com_helmfile_helmfile_git.ref=v4-3e1b5e9628a7/a.yaml"),
+	}
+	if diff := cmp.Diff(expectedFetched, fetched); diff != "" {
+		t.Errorf("unexpected fetched files:\n%s", diff)
+	}
+
+	expectedDownloads := map[string]int{
+		"git::https://github.com/helmfile/helmfile.git?ref=v1": 1,
+		"git::https://github.com/helmfile/helmfile.git?ref=v2": 1,
+		"git::https://github.com/helmfile/helmfile.git?ref=v3": 1,
+		"git::https://github.com/helmfile/helmfile.git?ref=v4": 1,
+	}
+	if diff := cmp.Diff(expectedDownloads, downloads); diff != "" {
+		t.Errorf("unexpected downloads:\n%s", diff)
+	}
+
+	if maxRunning > expectedMaxRun {
+		t.Errorf("unexpected concurrency: want at most %d downloads at once, got %d", expectedMaxRun, maxRunning)
+	}
+}
+
+func TestRemote_FetchAllGoGetter(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+
+	bundles := map[string][]byte{}
+	for _, name := range names {
+		bundles["/"+name+".tgz"] = tarGz(t, map[string]string{"values.yaml": "name: " + name})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bundle, ok := bundles[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(bundle)
+	}))
+	defer srv.Close()
+
+	logger := helmexec.NewLogger(io.Discard, "debug")
+
+	var srcs []string
+	for _, name := range names {
+		srcs = append(srcs, srv.URL+"/"+name+".tgz@values.yaml")
+	}
+
+	// Run with -race: go-getter's clients set themselves on their getters, which must not be shared by concurrent downloads
+	for i := 0; i < 5; i++ {
+		remote := &Remote{
+			Logger: logger,
+			Home:   t.TempDir(),
+			Getter: &GoGetter{Logger: logger},
+			fs:     filesystem.DefaultFileSystem(),
+		}
+
+		fetched, err := remote.FetchAll(srcs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for j, src := range srcs {
+			if bs, err := os.ReadFile(fetched[src]); err != nil || string(bs) != "name: "+names[j] {
+				t.Errorf("unexpected content of %s: %q, %v", src, string(bs), err)
+			}
+		}
+	}
+}
+
+func TestRemote_FetchAllErrors(t *testing.T) {
+	remote := &Remote{
+		Logger:  helmexec.NewLogger(io.Discard, "debug"),
+		Home:    t.TempDir(),
+		Offline: true,
+		Getter:  &testGetter{get: func(wd, src, dst string) error { return nil }},
+		fs:      filesystem.DefaultFileSystem(),
+	}
+
+	_, err := remote.FetchAll([]string{
+		"https://github.com/helmfile/helmfile.git",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v1",
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{"invalid src format", "offline mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestRemote_Prefetch(t *testing.T) {
+	connected := &Remote{
+		Logger: helmexec.NewLogger(io.Discard, "debug"),
+		Home:   t.TempDir(),
+		Getter: &MemGetter{Files: map[string]map[string]string{
+			"git::https://github.com/helmfile/helmfile.git?ref=v1": {"a.yaml": "a: 1", "b.yaml": "b: 1"},
+			"git::https://github.com/helmfile/helmfile.git?ref=v2": {"a.yaml": "a: 2"},
+		}},
+		fs: filesystem.DefaultFileSystem(),
+	}
+
+	srcs := []string{
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v1",
+		"git::https://github.com/helmfile/helmfile.git@b.yaml?ref=v1",
+		"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=v2",
+	}
+
+	if err := connected.Prefetch(srcs, "values"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The cache populated by Prefetch is enough to fetch the files offline
+	offline := &Remote{
+		Logger:  helmexec.NewLogger(io.Discard, "debug"),
+		Home:    connected.Home,
+		Offline: true,
+		Getter:  &MemGetter{},
+		fs:      filesystem.DefaultFileSystem(),
+	}
+
+	for _, src := range srcs {
+		res, err := offline.FetchWithResult(context.Background(), src, "values")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.CacheHit {
+			t.Errorf("expected %s to be served from the prefetched cache", src)
+		}
+	}
+
+	err := connected.Prefetch([]string{"git::https://github.com/helmfile/helmfile.git@a.yaml?ref=missing"}, "values")
+	if err == nil || !strings.Contains(err.Error(), "ref=missing") {
+		t.Errorf("expected the failed fetch to be reported, got %v", err)
+	}
+
+	connected.NoCache = true
+	if err := connected.Prefetch(srcs, "values"); err == nil {
+		t.Errorf("expected prefetching to fail with the cache disabled")
+	}
+}
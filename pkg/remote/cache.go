@@ -0,0 +1,535 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+	"go.uber.org/multierr"
+
+	"github.com/helmfile/helmfile/pkg/envvar"
+)
+
+// cacheMetadataSuffix is appended to a cache entry's directory path to get the path of its metadata file.
+// The metadata lives beside the entry rather than inside it so that it never ends up in what the getter downloaded.
+const cacheMetadataSuffix = ".metadata.json"
+
+// cacheLockSuffix is appended to a cache entry's directory path to get the path of the file locked while the entry is populated.
+// The lock file is never removed, not even along with its entry: a process blocked on the lock holds the file it opened,
+// so if the file were unlinked and recreated by another process, both would lock a different file and populate the entry at once.
+const cacheLockSuffix = ".lock"
+
+// cachePartialSuffix is appended to a cache entry's directory path to get the path of a single file being downloaded,
+// which is kept after a failed download so that the next one can resume it
+const cachePartialSuffix = ".partial"
+
+// cacheTmpInfix separates a cache entry's directory path from the random suffix of the temporary directory it is downloaded into
+const cacheTmpInfix = ".tmp-"
+
+// cacheFailedSuffix is appended to a cache entry's directory path to get the path where a failed download is kept
+// when KeepFailedDownloads is set. It holds what the getter left in its destination, under src.
+const cacheFailedSuffix = ".failed"
+
+// cacheLockRetryDelay is how often a process waiting for another one to populate a cache entry retries locking it
+const cacheLockRetryDelay = 100 * time.Millisecond
+
+type cacheMetadata struct {
+	FetchedAt time.Time `json:"fetchedAt"`
+
+	// Source is the source the entry was downloaded from, with credentials redacted.
+	// It is empty for entries written by older versions of helmfile.
+	Source string `json:"source,omitempty"`
+}
+
+func (r *Remote) readCacheMetadata(cacheDirPath string) (*cacheMetadata, error) {
+	bs, err := r.fs.ReadFile(cacheDirPath + cacheMetadataSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var m cacheMetadata
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func writeCacheMetadata(cacheDirPath string, m cacheMetadata) error {
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(cacheDirPath+cacheMetadataSuffix, bs, 0644)
+}
+
+// cacheExpired returns true when the cache entry was fetched longer than r.CacheMaxAge ago.
+// Entries without readable metadata have an unknown age, so they are considered expired.
+func (r *Remote) cacheExpired(cacheDirPath string) bool {
+	if r.CacheMaxAge <= 0 {
+		return false
+	}
+
+	m, err := r.readCacheMetadata(cacheDirPath)
+	if err != nil {
+		r.logger().Debugf("remote> unable to read cache metadata for %s: %v", cacheDirPath, err)
+		return true
+	}
+
+	return time.Since(m.FetchedAt) > r.CacheMaxAge
+}
+
+// warnIfStale warns when the cache entry was fetched longer than r.CacheWarnAge ago.
+// Entries without readable metadata are aged by the modification time of their directory.
+func (r *Remote) warnIfStale(cacheDirPath string) {
+	if r.CacheWarnAge <= 0 {
+		return
+	}
+
+	var fetchedAt time.Time
+	if m, err := r.readCacheMetadata(cacheDirPath); err == nil {
+		fetchedAt = m.FetchedAt
+	} else if info, err := os.Stat(cacheDirPath); err == nil {
+		fetchedAt = info.ModTime()
+	} else {
+		r.logger().Debugf("remote> unable to tell the age of %s: %v", cacheDirPath, err)
+		return
+	}
+
+	if age := time.Since(fetchedAt); age > r.CacheWarnAge {
+		r.logger().Warnf("remote> serving %s fetched %s ago from the cache. Run `helmfile cache cleanup` or set %s to refresh it", cacheDirPath, age.Round(time.Second), envvar.CacheMaxAge)
+	}
+}
+
+// touchCacheEntry records that the cache entry was used, by updating the modification time of its metadata.
+// evictCache removes the entries used the longest time ago first.
+func (r *Remote) touchCacheEntry(cacheDirPath string) {
+	now := time.Now()
+	if err := os.Chtimes(cacheDirPath+cacheMetadataSuffix, now, now); err != nil {
+		r.logger().Debugf("remote> unable to record the use of %s: %v", cacheDirPath, err)
+	}
+}
+
+// removeCacheEntry removes the cache entry along with its metadata
+func removeCacheEntry(cacheDirPath string) error {
+	err := os.RemoveAll(cacheDirPath)
+	for _, suffix := range []string{cacheMetadataSuffix, cachePartialSuffix} {
+		if rmerr := os.Remove(cacheDirPath + suffix); rmerr != nil && !os.IsNotExist(rmerr) {
+			err = multierr.Append(err, rmerr)
+		}
+	}
+	return err
+}
+
+// IsCacheSidecar tells whether name is the name of one of the files kept next to a cache entry, such as its metadata or its lock,
+// or of the temporary directory it is downloaded into, rather than of a cache entry
+func IsCacheSidecar(name string) bool {
+	if strings.Contains(name, cacheTmpInfix) {
+		return true
+	}
+	for _, suffix := range []string{cacheMetadataSuffix, cacheLockSuffix, cachePartialSuffix, cacheFailedSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockCacheEntry takes an advisory lock on the cache entry so that concurrent helmfile processes don't populate it at the same time.
+// A process that has to wait for the lock will see the entry as cached once the lock is released.
+// The returned function releases the lock.
+func (r *Remote) lockCacheEntry(ctx context.Context, cacheDirPath string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(cacheDirPath), 0755); err != nil {
+		// The cache may be pre-populated and read-only, in which case nobody can be writing to it either
+		r.logger().Debugf("remote> not locking %s: %v", cacheDirPath, err)
+		return func() {}, nil
+	}
+
+	lock := flock.New(cacheDirPath + cacheLockSuffix)
+
+	locked, err := lock.TryLockContext(ctx, cacheLockRetryDelay)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("waiting for the lock on %s: %w", cacheDirPath, err)
+		}
+		r.logger().Debugf("remote> not locking %s: %v", cacheDirPath, err)
+		return func() {}, nil
+	}
+	if !locked {
+		return nil, fmt.Errorf("unable to lock %s", cacheDirPath)
+	}
+
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			r.logger().Warnf("remote> unable to unlock %s: %v", cacheDirPath, err)
+		}
+	}, nil
+}
+
+// populateCacheEntry runs download into a temporary directory next to cacheDirPath and renames it into place only on success.
+// That way an interrupted download never leaves behind a directory that a later Fetch would mistake for a complete cache entry.
+func (r *Remote) populateCacheEntry(download func(dst string) error, cacheDirPath, source string) error {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(cacheDirPath), filepath.Base(cacheDirPath)+cacheTmpInfix)
+	if err != nil {
+		return err
+	}
+
+	// go-getter wants to create the destination by itself. For example, the git getter would try to `git pull` in an existing dir.
+	tmpDst := filepath.Join(tmpDir, "src")
+
+	err = download(tmpDst)
+	if err != nil {
+		if r.KeepFailedDownloads {
+			return multierr.Append(err, r.keepFailedDownload(tmpDir, cacheDirPath))
+		}
+		rmerr := os.RemoveAll(tmpDir)
+		if rmerr != nil {
+			return multierr.Append(err, rmerr)
+		}
+		return err
+	}
+
+	if _, err := os.Stat(tmpDst); err == nil {
+		move := os.Rename
+		if r.ContentAddressed {
+			move = r.storeContent
+		}
+
+		if err := move(tmpDst, cacheDirPath); err != nil {
+			return multierr.Append(fmt.Errorf("moving the download into %s: %w", cacheDirPath, err), os.RemoveAll(tmpDir))
+		}
+
+		if err := writeCacheMetadata(cacheDirPath, cacheMetadata{FetchedAt: time.Now(), Source: source}); err != nil {
+			r.logger().Warnf("remote> unable to write cache metadata for %s: %v", cacheDirPath, err)
+		}
+	} else {
+		r.logger().Debugf("remote> getter downloaded nothing into %s", tmpDst)
+	}
+
+	return os.RemoveAll(tmpDir)
+}
+
+// keepFailedDownload moves the temporary directory of a failed download beside the cache entry, replacing any previously kept one
+func (r *Remote) keepFailedDownload(tmpDir, cacheDirPath string) error {
+	failedDir := cacheDirPath + cacheFailedSuffix
+
+	if err := os.RemoveAll(failedDir); err != nil {
+		return multierr.Append(err, os.RemoveAll(tmpDir))
+	}
+
+	if err := os.Rename(tmpDir, failedDir); err != nil {
+		return multierr.Append(fmt.Errorf("keeping the failed download into %s: %w", failedDir, err), os.RemoveAll(tmpDir))
+	}
+
+	r.logger().Warnf("remote> kept the failed download of %s in %s", cacheDirPath, failedDir)
+
+	return nil
+}
+
+// CleanCache removes the cache entries under r.Home, or only those of r.Namespace if set, that were fetched longer than olderThan ago.
+// It returns the number of removed entries and the number of bytes freed.
+// Only entries that have cache metadata, i.e. that were fetched by this version of helmfile or newer, are considered.
+func (r *Remote) CleanCache(olderThan time.Duration) (int, int64, error) {
+	if err := r.checkNamespace(); err != nil {
+		return 0, 0, err
+	}
+
+	entries, err := cacheEntries(r.cacheHome())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		removed int
+		freed   int64
+	)
+
+	for _, entry := range entries {
+		m, err := r.readCacheMetadata(entry)
+		if err != nil {
+			r.logger().Debugf("remote> skipping %s: unable to read cache metadata: %v", entry, err)
+			continue
+		}
+
+		if time.Since(m.FetchedAt) <= olderThan {
+			continue
+		}
+
+		n, err := r.removeCacheEntryLocked(entry)
+		if err != nil {
+			return removed, freed, err
+		}
+
+		r.logger().Debugf("remote> removed %s fetched at %s", entry, m.FetchedAt)
+
+		removed++
+		freed += n
+	}
+
+	n, err := r.pruneContentStore()
+	freed += n
+
+	return removed, freed, err
+}
+
+// removeCacheEntryLocked waits for any process populating the cache entry before removing it, and returns the bytes freed
+func (r *Remote) removeCacheEntryLocked(cacheDirPath string) (int64, error) {
+	unlock, err := r.lockCacheEntry(context.Background(), cacheDirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	size, err := dirSize(cacheDirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := removeCacheEntry(cacheDirPath); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// evictCache removes the least recently used cache entries until the cache takes no more than r.MaxCacheSize bytes.
+// keep is never removed, nor are the entries locked by other fetches. Failures are logged rather than returned,
+// as the fetch that triggered the eviction has succeeded.
+func (r *Remote) evictCache(keep string) {
+	if r.MaxCacheSize <= 0 {
+		return
+	}
+
+	entries, err := cacheEntries(r.Home)
+	if err != nil {
+		r.logger().Warnf("remote> unable to list the cache entries to evict: %v", err)
+		return
+	}
+
+	type usage struct {
+		path, dir string
+		usedAt    time.Time
+	}
+
+	var (
+		usages []usage
+		total  int64
+		sizes  = map[string]int64{}
+		refs   = map[string]int{}
+	)
+
+	for _, entry := range entries {
+		// Content-addressed entries share their directories, which are counted once
+		dir, err := filepath.EvalSymlinks(entry)
+		if err != nil {
+			r.logger().Debugf("remote> skipping %s: %v", entry, err)
+			continue
+		}
+
+		info, err := os.Stat(entry + cacheMetadataSuffix)
+		if err != nil {
+			r.logger().Debugf("remote> skipping %s: %v", entry, err)
+			continue
+		}
+
+		if _, ok := sizes[dir]; !ok {
+			size, err := dirSize(dir)
+			if err != nil {
+				r.logger().Debugf("remote> skipping %s: %v", entry, err)
+				continue
+			}
+			sizes[dir] = size
+			total += size
+		}
+		refs[dir]++
+
+		if entry != keep {
+			usages = append(usages, usage{path: entry, dir: dir, usedAt: info.ModTime()})
+		}
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].usedAt.Before(usages[j].usedAt)
+	})
+
+	evicted := false
+
+	for _, u := range usages {
+		if total <= r.MaxCacheSize {
+			break
+		}
+
+		lock := flock.New(u.path + cacheLockSuffix)
+		if locked, err := lock.TryLock(); err != nil || !locked {
+			r.logger().Debugf("remote> not evicting %s as it is in use", u.path)
+			continue
+		}
+
+		err := removeCacheEntry(u.path)
+		if unlockErr := lock.Unlock(); unlockErr != nil {
+			r.logger().Warnf("remote> unable to unlock %s: %v", u.path, unlockErr)
+		}
+		if err != nil {
+			r.logger().Warnf("remote> unable to evict %s: %v", u.path, err)
+			continue
+		}
+
+		r.logger().Debugf("remote> evicted %s, last used at %s, to keep the cache under %d bytes", u.path, u.usedAt.Format(time.RFC3339), r.MaxCacheSize)
+		evicted = true
+
+		if refs[u.dir]--; refs[u.dir] == 0 {
+			total -= sizes[u.dir]
+		}
+	}
+
+	if evicted {
+		if _, err := r.pruneContentStore(); err != nil {
+			r.logger().Warnf("remote> unable to prune the content store: %v", err)
+		}
+	}
+
+	if total > r.MaxCacheSize {
+		r.logger().Debugf("remote> the cache still takes %d bytes, over the limit of %d bytes", total, r.MaxCacheSize)
+	}
+}
+
+// CacheEntry describes a directory in the cache, as returned by ListCache
+type CacheEntry struct {
+	// Key is the path of the entry relative to the remote's Home, like FetchResult.CacheKey
+	Key string
+
+	// Source is the source the entry was downloaded from, with credentials redacted.
+	// It is empty when the entry was downloaded by a version of helmfile that didn't record it.
+	Source string
+
+	// Size is the total size in bytes of the files in the entry
+	Size int64
+
+	// FetchedAt is when the entry was downloaded
+	FetchedAt time.Time
+
+	// ModTime is when the directory of the entry was last modified
+	ModTime time.Time
+}
+
+// ListCache returns the entries of the cache under r.Home, or only those of r.Namespace if set, sorted by key.
+// Like CleanCache, it only considers entries that have cache metadata.
+func (r *Remote) ListCache() ([]CacheEntry, error) {
+	if err := r.checkNamespace(); err != nil {
+		return nil, err
+	}
+
+	entries, err := cacheEntries(r.cacheHome())
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]CacheEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		m, err := r.readCacheMetadata(entry)
+		if err != nil {
+			r.logger().Debugf("remote> skipping %s: unable to read cache metadata: %v", entry, err)
+			continue
+		}
+
+		key, err := filepath.Rel(r.Home, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		// Content-addressed entries are symlinks to the directory to measure
+		dir, err := filepath.EvalSymlinks(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := dirSize(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, CacheEntry{
+			Key:       filepath.ToSlash(key),
+			Source:    m.Source,
+			Size:      size,
+			FetchedAt: m.FetchedAt,
+			ModTime:   info.ModTime(),
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+
+	return list, nil
+}
+
+// cacheEntries returns the paths of all the cache entries found under home.
+// Entries can be nested at any depth, as callers of Fetch choose their own cache subdirectories, so they are found by their metadata.
+func cacheEntries(home string) ([]string, error) {
+	var entries []string
+
+	err := filepath.WalkDir(home, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == home {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if path == filepath.Join(home, contentStoreDir) {
+			// Content-addressed directories are found through the entries linking to them
+			return filepath.SkipDir
+		}
+
+		if (!d.IsDir() && d.Type()&fs.ModeSymlink == 0) || path == home {
+			return nil
+		}
+
+		if _, err := os.Stat(path + cacheMetadataSuffix); err == nil {
+			entries = append(entries, path)
+			// Don't walk into the downloaded files
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+
+		return nil
+	})
+
+	return entries, err
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size, err
+}
@@ -0,0 +1,178 @@
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// contentStoreDir is the directory under the remote's Home where content-addressed directories are stored
+const contentStoreDir = "cas"
+
+// contentStoreGracePeriod is how long a content-addressed directory is kept after it was stored or reused, even though
+// no cache entry links to it. A fetch links its entry to the content before writing the entry's metadata,
+// so a CleanCache running meanwhile must not take the content for unused.
+const contentStoreGracePeriod = 10 * time.Minute
+
+// storeContent moves the downloaded directory src into the content store, and links cacheDirPath to it.
+// When the store already has the same content, src is discarded.
+func (r *Remote) storeContent(src, cacheDirPath string) error {
+	sum, err := contentHash(src)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", src, err)
+	}
+
+	storeDir := filepath.Join(r.Home, contentStoreDir)
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		return err
+	}
+
+	contentDir := filepath.Join(storeDir, sum)
+
+	if err := os.Rename(src, contentDir); err != nil {
+		// Another fetch may have stored the same content in the meantime
+		if _, statErr := os.Stat(contentDir); statErr != nil {
+			return err
+		}
+		r.logger().Debugf("remote> %s is already stored as %s", cacheDirPath, contentDir)
+	}
+
+	// Reused content may be unlinked and old enough to be pruned, which must not happen until the entry links to it
+	now := time.Now()
+	if err := os.Chtimes(contentDir, now, now); err != nil {
+		return err
+	}
+
+	// A relative link keeps working when the whole cache is moved
+	target, err := filepath.Rel(filepath.Dir(cacheDirPath), contentDir)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(target, cacheDirPath)
+}
+
+// contentHash returns the hex-encoded SHA-256 of the paths, modes and contents of the files in dir.
+// The .git directory of a git checkout differs from clone to clone, so it is left out.
+func contentHash(dir string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && rel == ".git" {
+			return filepath.SkipDir
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		case d.Type().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pruneContentStore removes the content-addressed directories that no cache entry links to anymore, and returns the bytes freed.
+// Directories stored or reused within contentStoreGracePeriod are kept, as a concurrent fetch may be about to link to them.
+func (r *Remote) pruneContentStore() (int64, error) {
+	storeDir := filepath.Join(r.Home, contentStoreDir)
+
+	stored, err := os.ReadDir(storeDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	entries, err := cacheEntries(r.Home)
+	if err != nil {
+		return 0, err
+	}
+
+	linked := map[string]bool{}
+	for _, entry := range entries {
+		if target, err := filepath.EvalSymlinks(entry); err == nil {
+			linked[target] = true
+		}
+	}
+
+	resolvedStoreDir, err := filepath.EvalSymlinks(storeDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var freed int64
+
+	for _, s := range stored {
+		if linked[filepath.Join(resolvedStoreDir, s.Name())] {
+			continue
+		}
+
+		contentDir := filepath.Join(storeDir, s.Name())
+
+		info, err := s.Info()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return freed, err
+		}
+		if time.Since(info.ModTime()) < contentStoreGracePeriod {
+			r.logger().Debugf("remote> keeping %s as it was stored %s ago and may be in use by a fetch", contentDir, time.Since(info.ModTime()).Round(time.Second))
+			continue
+		}
+
+		size, err := dirSize(contentDir)
+		if err != nil {
+			return freed, err
+		}
+
+		if err := os.RemoveAll(contentDir); err != nil {
+			return freed, err
+		}
+
+		r.logger().Debugf("remote> removed %s as no cache entry links to it", contentDir)
+
+		freed += size
+	}
+
+	return freed, nil
+}
@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// RemoteNotFoundError is returned by Fetch when the remote source does not exist
+type RemoteNotFoundError struct {
+	err error
+}
+
+func (e RemoteNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+func (e RemoteNotFoundError) Unwrap() error {
+	return e.err
+}
+
+// RemoteAuthError is returned by Fetch when the remote refused the credentials, or when there were none
+type RemoteAuthError struct {
+	err error
+}
+
+func (e RemoteAuthError) Error() string {
+	return e.err.Error()
+}
+
+func (e RemoteAuthError) Unwrap() error {
+	return e.err
+}
+
+// RemoteServerError is returned by Fetch when the remote failed to serve the source
+type RemoteServerError struct {
+	err error
+}
+
+func (e RemoteServerError) Error() string {
+	return e.err.Error()
+}
+
+func (e RemoteServerError) Unwrap() error {
+	return e.err
+}
+
+// goGetterStatusRegexp matches the status codes found in the errors of go-getter's http and s3 getters,
+// as go-getter flattens them into strings
+var goGetterStatusRegexp = regexp.MustCompile(`(?:bad response code|status code): (\d{3})`)
+
+// errorForStatus returns the typed error corresponding to the HTTP status the remote responded with.
+// err is returned as is when the status doesn't tell what went wrong.
+func errorForStatus(status int, err error) error {
+	switch {
+	case status == http.StatusNotFound:
+		return RemoteNotFoundError{err: err}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return RemoteAuthError{err: err}
+	case status >= 500:
+		return RemoteServerError{err: err}
+	}
+	return err
+}
+
+// goGetterError types the error returned by go-getter from the status code it mentions, if any
+func goGetterError(err error) error {
+	m := goGetterStatusRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+
+	status, _ := strconv.Atoi(m[1])
+
+	return errorForStatus(status, err)
+}
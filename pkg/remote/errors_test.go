@@ -0,0 +1,66 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestGoGetter_Errors(t *testing.T) {
+	type testcase struct {
+		status int
+		check  func(error) bool
+	}
+
+	testcases := []testcase{
+		{status: http.StatusNotFound, check: func(err error) bool { _, ok := err.(RemoteNotFoundError); return ok }},
+		{status: http.StatusUnauthorized, check: func(err error) bool { _, ok := err.(RemoteAuthError); return ok }},
+		{status: http.StatusForbidden, check: func(err error) bool { _, ok := err.(RemoteAuthError); return ok }},
+		{status: http.StatusBadGateway, check: func(err error) bool { _, ok := err.(RemoteServerError); return ok }},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			g := &GoGetter{Logger: helmexec.NewLogger(io.Discard, "debug")}
+
+			dst := filepath.Join(t.TempDir(), "dst")
+
+			err := g.Get(context.Background(), t.TempDir(), srv.URL+"/charts", dst)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tc.check(err) {
+				t.Errorf("unexpected error type %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestErrorForStatus(t *testing.T) {
+	err := errors.New("bad request")
+
+	if got := errorForStatus(http.StatusBadRequest, err); got != err {
+		t.Errorf("expected the error to be returned as is, got %T: %v", got, got)
+	}
+
+	if got := errorForStatus(http.StatusNotFound, err); got != (RemoteNotFoundError{err: err}) {
+		t.Errorf("unexpected error %T: %v", got, got)
+	}
+
+	if got := errorForStatus(http.StatusNotFound, err); !errors.Is(got, err) {
+		t.Errorf("expected %v to wrap %v", got, err)
+	}
+}
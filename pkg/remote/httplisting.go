@@ -0,0 +1,184 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// httpListingGetterName is the forced getter that selects HTTPListingGetter, as in httplist::https://...
+const httpListingGetterName = "httplist"
+
+// defaultHTTPListing is the URL of the listing of a directory when HTTPListingGetter.Listing is empty
+const defaultHTTPListing = "{dir}/index.json"
+
+// HTTPListingGetter downloads all the files of a directory served over plain http(s), which go-getter can't list.
+// The server must serve a listing of the directory, as a JSON array of the paths of the files relative to the directory.
+// The source must be of the form httplist::https://<host>/<path/to/dir>.
+// Its query is sent with every request, along with the headers of RequestHeader.
+type HTTPListingGetter struct {
+	// Logger is used to log the downloads. If nil, nothing is logged.
+	Logger *zap.SugaredLogger
+
+	// Listing is the URL of the listing, where `{dir}` is replaced by the URL of the directory without its query,
+	// e.g. `{dir}?list=json`. Defaults to defaultHTTPListing.
+	Listing string
+
+	// UserAgent is sent in the User-Agent header of the requests, if set
+	UserAgent string
+
+	// BearerToken is sent in the `Authorization: Bearer <token>` header of the requests, if set,
+	// unless the source sets its own with the token parameter
+	BearerToken string
+
+	// HTTPClient is used instead of http.DefaultClient, if set
+	HTTPClient *http.Client
+}
+
+func (g *HTTPListingGetter) Get(ctx context.Context, wd, src, dst string) error {
+	u, err := neturl.Parse(strings.TrimPrefix(src, httpListingGetterName+"::"))
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported %s scheme %q: it must be http or https", httpListingGetterName, u.Scheme)
+	}
+
+	query := u.RawQuery
+	u.RawQuery = ""
+	dirURL := strings.TrimSuffix(u.String(), "/")
+
+	listing := g.Listing
+	if listing == "" {
+		listing = defaultHTTPListing
+	}
+
+	files, err := g.list(ctx, withRawQuery(strings.ReplaceAll(listing, "{dir}", dirURL), query))
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return RemoteNotFoundError{err: fmt.Errorf("no files listed under %s", u.Redacted())}
+	}
+
+	for _, file := range files {
+		localPath := filepath.Join(dst, filepath.FromSlash(file))
+		if err := checkWithinDir(dst, localPath); err != nil || localPath == filepath.Clean(dst) {
+			return fmt.Errorf("listed file %q would be written outside of %s", file, dst)
+		}
+
+		fileURL := dirURL + "/" + (&neturl.URL{Path: strings.TrimPrefix(file, "/")}).EscapedPath()
+
+		loggerOrNop(g.Logger).Debugf("httplist> downloading %s/%s to %s", u.Redacted(), file, localPath)
+
+		if err := g.download(ctx, withRawQuery(fileURL, query), localPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list returns the paths of the files in the listing at listingURL
+func (g *HTTPListingGetter) list(ctx context.Context, listingURL string) ([]string, error) {
+	resp, err := g.get(ctx, listingURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var files []string
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, fmt.Errorf("decoding the listing %s: it must be a JSON array of file paths: %w", redactURL(listingURL), err)
+	}
+
+	return files, nil
+}
+
+func (g *HTTPListingGetter) download(ctx context.Context, fileURL, localPath string) error {
+	resp, err := g.get(ctx, fileURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return fmt.Errorf("downloading %s: %w", redactURL(fileURL), err)
+	}
+
+	return nil
+}
+
+// get sends a GET request to rawURL and returns the response, which is successful
+func (g *HTTPListingGetter) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range RequestHeader(ctx) {
+		req.Header[k] = v
+	}
+	if g.UserAgent != "" {
+		req.Header.Set("User-Agent", g.UserAgent)
+	}
+	if g.BearerToken != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+g.BearerToken)
+	}
+
+	client := g.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errorForStatus(resp.StatusCode, fmt.Errorf("GET %s: bad response code: %d", redactURL(rawURL), resp.StatusCode))
+	}
+
+	return resp, nil
+}
+
+// withRawQuery appends the raw query to rawURL, which may already have one
+func withRawQuery(rawURL, query string) string {
+	if query == "" {
+		return rawURL
+	}
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
+
+// redactURL returns rawURL with the password of its user info, if any, redacted
+func redactURL(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
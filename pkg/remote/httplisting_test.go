@@ -0,0 +1,109 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestHTTPListingGetter(t *testing.T) {
+	files := map[string]string{
+		"/charts/index.json":     `["values.yaml", "envs/prod.yaml"]`,
+		"/charts/values.yaml":    "foo: bar",
+		"/charts/envs/prod.yaml": "env: prod",
+		"/evil/index.json":       `["../../outside.yaml"]`,
+		"/empty/index.json":      `[]`,
+		"/custom/files":          `["values.yaml"]`,
+		"/custom/values.yaml":    "custom: true",
+	}
+
+	var gotQueries []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQueries = append(gotQueries, r.URL.RawQuery)
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer srv.Close()
+
+	logger := helmexec.NewLogger(io.Discard, "debug")
+
+	newRemote := func(listing string) *Remote {
+		r := &Remote{
+			Logger: logger,
+			Home:   t.TempDir(),
+			Getter: getterFunc(func(ctx context.Context, wd, src, dst string) error {
+				return fmt.Errorf("unexpected download of %s with the default getter", src)
+			}),
+			fs: filesystem.DefaultFileSystem(),
+		}
+		r.RegisterGetter(httpListingGetterName, &HTTPListingGetter{Logger: logger, Listing: listing})
+		return r
+	}
+
+	t.Run("default listing", func(t *testing.T) {
+		gotQueries = nil
+
+		remote := newRemote("")
+
+		path, err := remote.Fetch("httplist::" + srv.URL + "/charts@envs/prod.yaml?v=1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if bs, err := os.ReadFile(path); err != nil || string(bs) != "env: prod" {
+			t.Errorf("unexpected content of %s: %q, %v", path, string(bs), err)
+		}
+		if bs, err := os.ReadFile(filepath.Join(filepath.Dir(filepath.Dir(path)), "values.yaml")); err != nil || string(bs) != "foo: bar" {
+			t.Errorf("expected every listed file to be downloaded: %q, %v", string(bs), err)
+		}
+
+		for _, q := range gotQueries {
+			if q != "v=1" {
+				t.Errorf("expected the query to be sent with every request, got %q", q)
+			}
+		}
+	})
+
+	t.Run("custom listing", func(t *testing.T) {
+		remote := newRemote("{dir}/files?format=json")
+
+		path, err := remote.Fetch("httplist::" + srv.URL + "/custom@values.yaml")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if bs, err := os.ReadFile(path); err != nil || string(bs) != "custom: true" {
+			t.Errorf("unexpected content of %s: %q, %v", path, string(bs), err)
+		}
+	})
+
+	t.Run("files outside of the directory", func(t *testing.T) {
+		_, err := newRemote("").Fetch("httplist::" + srv.URL + "/evil@values.yaml")
+		if err == nil || !strings.Contains(err.Error(), "would be written outside of") {
+			t.Errorf("expected the listed file to be refused, got %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, dir := range []string{"/empty", "/missing"} {
+			_, err := newRemote("").Fetch("httplist::" + srv.URL + dir + "@values.yaml")
+			var notFound RemoteNotFoundError
+			if !errors.As(err, &notFound) {
+				t.Errorf("expected a RemoteNotFoundError for %s, got %v", dir, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemGetter is a Getter that serves predefined files instead of downloading them, and records the sources it was asked for.
+// It lets packages that depend on Remote test Fetch and Locate without network access, e.g.:
+//
+//	r.Getter = &remote.MemGetter{Files: map[string]map[string]string{
+//		"git::https://github.com/org/repo.git?ref=v1": {"values.yaml": "foo: bar"},
+//	}}
+type MemGetter struct {
+	// Files maps the sources, as received by Get, to the files of the directory they download.
+	// File paths are slash-separated and relative to the directory.
+	Files map[string]map[string]string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// Get writes the files of src to dst, or returns a RemoteNotFoundError when src is not in Files
+func (g *MemGetter) Get(ctx context.Context, wd, src, dst string) error {
+	g.mu.Lock()
+	g.calls = append(g.calls, src)
+	g.mu.Unlock()
+
+	files, ok := g.Files[src]
+	if !ok {
+		return RemoteNotFoundError{err: fmt.Errorf("%s is not in MemGetter.Files", src)}
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dst, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Calls returns the sources Get was called with, in order
+func (g *MemGetter) Calls() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.calls...)
+}
@@ -0,0 +1,57 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestMemGetter(t *testing.T) {
+	get := &MemGetter{Files: map[string]map[string]string{
+		"git::https://github.com/org/repo.git?ref=v1": {
+			"values.yaml":        "foo: bar",
+			"nested/values.yaml": "baz: qux",
+		},
+	}}
+
+	remote := &Remote{
+		Logger: helmexec.NewLogger(io.Discard, "debug"),
+		Home:   t.TempDir(),
+		Getter: get,
+		fs:     filesystem.DefaultFileSystem(),
+	}
+
+	for src, want := range map[string]string{
+		"git::https://github.com/org/repo.git@values.yaml?ref=v1":        "foo: bar",
+		"git::https://github.com/org/repo.git@nested/values.yaml?ref=v1": "baz: qux",
+	} {
+		file, err := remote.Locate(src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if bs, err := os.ReadFile(file); err != nil || string(bs) != want {
+			t.Errorf("unexpected content of %s: %q, %v", file, string(bs), err)
+		}
+	}
+
+	_, err := remote.Fetch("git::https://github.com/org/repo.git@values.yaml?ref=v2")
+	var notFound RemoteNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected RemoteNotFoundError, got %v", err)
+	}
+
+	// The second file was served from the cache
+	if diff := cmp.Diff([]string{
+		"git::https://github.com/org/repo.git?ref=v1",
+		"git::https://github.com/org/repo.git?ref=v2",
+	}, get.Calls()); diff != "" {
+		t.Errorf("unexpected calls:\n%s", diff)
+	}
+}
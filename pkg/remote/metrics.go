@@ -0,0 +1,74 @@
+package remote
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics is notified of the outcome of Fetch, for programs that want to observe remote fetching.
+// Remote reports nothing unless its Metrics field is set.
+type Metrics interface {
+	// CacheHit is called when Fetch serves a remote directory from the cache
+	CacheHit(scheme string)
+
+	// Downloaded is called after Fetch tried to download a remote directory.
+	// bytes is the size of the downloaded directory. It is zero when the download failed.
+	Downloaded(scheme string, duration time.Duration, bytes int64, err error)
+}
+
+// PrometheusMetrics is a Metrics that records fetches, download durations and downloaded bytes as Prometheus metrics
+type PrometheusMetrics struct {
+	fetches  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics and registers its collectors to reg
+func NewPrometheusMetrics(reg prometheus.Registerer) (*PrometheusMetrics, error) {
+	m := &PrometheusMetrics{
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "helmfile",
+			Subsystem: "remote",
+			Name:      "fetches_total",
+			Help:      "Number of remote directories fetched, by scheme and result: cache_hit, downloaded or error.",
+		}, []string{"scheme", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "helmfile",
+			Subsystem: "remote",
+			Name:      "download_duration_seconds",
+			Help:      "Time spent downloading remote directories, by scheme.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 10),
+		}, []string{"scheme"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "helmfile",
+			Subsystem: "remote",
+			Name:      "downloaded_bytes_total",
+			Help:      "Size of the remote directories downloaded, by scheme.",
+		}, []string{"scheme"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.fetches, m.duration, m.bytes} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *PrometheusMetrics) CacheHit(scheme string) {
+	m.fetches.WithLabelValues(scheme, "cache_hit").Inc()
+}
+
+func (m *PrometheusMetrics) Downloaded(scheme string, duration time.Duration, bytes int64, err error) {
+	m.duration.WithLabelValues(scheme).Observe(duration.Seconds())
+
+	if err != nil {
+		m.fetches.WithLabelValues(scheme, "error").Inc()
+		return
+	}
+
+	m.fetches.WithLabelValues(scheme, "downloaded").Inc()
+	m.bytes.WithLabelValues(scheme).Add(float64(bytes))
+}
@@ -0,0 +1,72 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestRemote_Metrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	metrics, err := NewPrometheusMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fail := false
+
+	get := func(wd, src, dst string) error {
+		if fail {
+			return errors.New("unreachable")
+		}
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, "values.yaml"), []byte("foo: bar"), 0644)
+	}
+
+	remote := &Remote{
+		Logger:  helmexec.NewLogger(io.Discard, "debug"),
+		Home:    t.TempDir(),
+		Metrics: metrics,
+		Getter:  &testGetter{get: get},
+		fs:      filesystem.DefaultFileSystem(),
+	}
+
+	url := "git::https://github.com/helmfile/helmfile.git@values.yaml?ref=main"
+
+	// The first fetch downloads, the second one is served from the cache
+	for i := 0; i < 2; i++ {
+		if _, err := remote.Fetch(url); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	fail = true
+	if _, err := remote.Fetch("git::https://github.com/helmfile/helmfile.git@values.yaml?ref=v0.151.0"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, result := range []string{"downloaded", "cache_hit", "error"} {
+		if got := testutil.ToFloat64(metrics.fetches.WithLabelValues("https", result)); got != 1 {
+			t.Errorf("unexpected number of %s fetches: want 1, got %v", result, got)
+		}
+	}
+
+	if got := testutil.ToFloat64(metrics.bytes.WithLabelValues("https")); got != float64(len("foo: bar")) {
+		t.Errorf("unexpected downloaded bytes: want %d, got %v", len("foo: bar"), got)
+	}
+
+	if got := testutil.CollectAndCount(metrics.duration); got != 1 {
+		t.Errorf("unexpected number of download duration series: want 1, got %d", got)
+	}
+}
@@ -0,0 +1,86 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-getter"
+	"go.uber.org/zap"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// OCIGetter pulls a chart artifact from an OCI registry and extracts it into the destination directory.
+// The source must be of the form oci://<registry>/<repository>:<tag>.
+// Credentials are read by helm's registry client, which falls back to the docker config file.
+type OCIGetter struct {
+	Logger *zap.SugaredLogger
+}
+
+func (g *OCIGetter) Get(ctx context.Context, wd, src, dst string) error {
+	ref, err := ParseOCIReference(src)
+	if err != nil {
+		return err
+	}
+
+	client, err := registry.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating registry client: %w", err)
+	}
+
+	loggerOrNop(g.Logger).Debugf("oci> pulling %s", ref)
+
+	// helm's registry client doesn't take a context, so the best we can do is to not start a cancelled pull
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	res, err := client.Pull(ref)
+	if err != nil {
+		return fmt.Errorf("pulling %s: %w", ref, err)
+	}
+
+	tmp, err := os.CreateTemp("", "helmfile-oci-*.tgz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(res.Chart.Data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", tmp.Name(), err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := new(getter.TarGzipDecompressor).Decompress(dst, tmp.Name(), true, 0); err != nil {
+		return fmt.Errorf("extracting %s: %w", ref, err)
+	}
+
+	return nil
+}
+
+// ParseOCIReference turns oci://<registry>/<repository>:<tag> into the reference accepted by helm's registry client.
+func ParseOCIReference(src string) (string, error) {
+	if !strings.HasPrefix(src, "oci://") {
+		return "", fmt.Errorf("unsupported oci reference %q: it must start with oci://", src)
+	}
+
+	ref := strings.TrimPrefix(src, "oci://")
+	if i := strings.Index(ref, "?"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	if !strings.Contains(ref, "/") {
+		return "", fmt.Errorf("invalid oci reference: it must be `oci://<registry>/<repository>:<tag>`: got %s", src)
+	}
+
+	return ref, nil
+}
@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/helmfile/helmfile/pkg/helmexec"
+	"github.com/helmfile/helmfile/pkg/testhelper"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	type testcase struct {
+		input, ref, err string
+	}
+
+	testcases := []testcase{
+		{
+			input: "oci://ghcr.io/helmfile/charts/app:1.2.3",
+			ref:   "ghcr.io/helmfile/charts/app:1.2.3",
+		},
+		{
+			input: "oci://localhost:5000/app:1.2.3?foo=bar",
+			ref:   "localhost:5000/app:1.2.3",
+		},
+		{
+			input: "oci://ghcr.io",
+			err:   "invalid oci reference: it must be `oci://<registry>/<repository>:<tag>`: got oci://ghcr.io",
+		},
+		{
+			input: "https://ghcr.io/helmfile/charts/app",
+			err:   `unsupported oci reference "https://ghcr.io/helmfile/charts/app": it must start with oci://`,
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(fmt.Sprintf("case %d", i), func(t *testing.T) {
+			ref, err := ParseOCIReference(tc.input)
+
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+
+			if diff := cmp.Diff(tc.err, errMsg); diff != "" {
+				t.Fatalf("Unexpected error:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.ref, ref); diff != "" {
+				t.Fatalf("Unexpected ref:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemote_OCI(t *testing.T) {
+	testfs := testhelper.NewTestFs(map[string]string{
+		CacheDir(): "",
+	})
+
+	get := func(wd, src, dst string) error {
+		return fmt.Errorf("unexpected call to go-getter with src: %s", src)
+	}
+
+	var pulled string
+	ociGet := func(wd, src, dst string) error {
+		pulled = src
+		return nil
+	}
+
+	remote := &Remote{
+		Logger: helmexec.NewLogger(io.Discard, "debug"),
+		Home:   CacheDir(),
+		Getter: &testGetter{get: get},
+		fs:     testfs.ToFileSystem(),
+	}
+
+	remote.RegisterGetter("oci", &testGetter{get: ociGet})
+
+	file, err := remote.Fetch("oci://ghcr.io/helmfile/charts/app:1.2.3@app/values.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if pulled != "oci://ghcr.io/helmfile/charts/app:1.2.3" {
+		t.Errorf("unexpected src: %s", pulled)
+	}
+
+	expectedFile := filepath.Join(CacheDir(), "oci_ghcr_io_helmfile_charts_app1_2_3-5bbe72761f78/app/values.yaml")
+	if file != expectedFile {
+		t.Errorf("unexpected file located: %s vs expected: %s", file, expectedFile)
+	}
+}
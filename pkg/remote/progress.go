@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressReportInterval is how often ProgressWriter reports the progress of a download
+const progressReportInterval = time.Second
+
+// ProgressWriter is a go-getter ProgressTracker that writes the number of bytes transferred to W.
+// Progress is reported at most once per second per download, and once more when the download completes.
+type ProgressWriter struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+func (p *ProgressWriter) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) io.ReadCloser {
+	return &progressReader{
+		ReadCloser: stream,
+		writer:     p,
+		src:        src,
+		read:       currentSize,
+		total:      totalSize,
+	}
+}
+
+func (p *ProgressWriter) report(src string, read, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if total > 0 {
+		fmt.Fprintf(p.W, "downloading %s: %d/%d bytes\n", src, read, total)
+	} else {
+		fmt.Fprintf(p.W, "downloading %s: %d bytes\n", src, read)
+	}
+}
+
+type progressReader struct {
+	io.ReadCloser
+
+	writer     *ProgressWriter
+	src        string
+	read       int64
+	total      int64
+	reportedAt time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+
+	if now := time.Now(); now.Sub(r.reportedAt) >= progressReportInterval {
+		r.reportedAt = now
+		r.writer.report(r.src, r.read, r.total)
+	}
+
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	r.writer.report(r.src, r.read, r.total)
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,35 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var out bytes.Buffer
+
+	p := &ProgressWriter{W: &out}
+
+	stream := p.TrackProgress("https://example.com/charts.tgz", 0, 6, io.NopCloser(strings.NewReader("foobar")))
+
+	bs, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(bs) != "foobar" {
+		t.Errorf("unexpected content read: %s", bs)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if diff := cmp.Diff("downloading https://example.com/charts.tgz: 6/6 bytes", lines[len(lines)-1]); diff != "" {
+		t.Errorf("unexpected final progress:\n%s", diff)
+	}
+}
@@ -0,0 +1,39 @@
+package remote
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter returns the limiter shared by all the downloads of r, or nil when FetchRPS doesn't limit them
+func (r *Remote) rateLimiter() *rate.Limiter {
+	if r.FetchRPS <= 0 {
+		return nil
+	}
+
+	r.limiterMu.Lock()
+	defer r.limiterMu.Unlock()
+
+	if r.limiter == nil || r.limiter.Limit() != rate.Limit(r.FetchRPS) {
+		// A burst of 1 spaces the downloads evenly rather than letting a batch of them start at once
+		r.limiter = rate.NewLimiter(rate.Limit(r.FetchRPS), 1)
+	}
+
+	return r.limiter
+}
+
+// withRateLimit returns a download that waits for its turn under r.FetchRPS before each call to download
+func (r *Remote) withRateLimit(ctx context.Context, download func(dst string) error) func(dst string) error {
+	limiter := r.rateLimiter()
+	if limiter == nil {
+		return download
+	}
+
+	return func(dst string) error {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		return download(dst)
+	}
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestRemote_FetchRPS(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		downloads int
+	)
+
+	remote := &Remote{
+		Logger:           helmexec.NewLogger(io.Discard, "debug"),
+		Home:             t.TempDir(),
+		FetchRPS:         20,
+		FetchConcurrency: 4,
+		Getter: getterFunc(func(ctx context.Context, wd, src, dst string) error {
+			mu.Lock()
+			downloads++
+			mu.Unlock()
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dst, "values.yaml"), []byte("foo: bar"), 0644)
+		}),
+		fs: filesystem.DefaultFileSystem(),
+	}
+
+	var srcs []string
+	for i := 0; i < 4; i++ {
+		srcs = append(srcs, fmt.Sprintf("git::https://github.com/helmfile/helmfile.git@values.yaml?ref=v%d", i))
+	}
+
+	start := time.Now()
+	if _, err := remote.FetchAll(srcs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if downloads != len(srcs) {
+		t.Fatalf("unexpected number of downloads: %d", downloads)
+	}
+
+	// The first download starts right away, and each of the others waits for 1/20 s
+	if elapsed, min := time.Since(start), 3*50*time.Millisecond-10*time.Millisecond; elapsed < min {
+		t.Errorf("expected the concurrent downloads to be throttled to take at least %s, took %s", min, elapsed)
+	}
+
+	// The fetches served from the cache aren't throttled
+	start = time.Now()
+	if _, err := remote.FetchAll(srcs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("expected the cache hits not to be throttled, took %s", elapsed)
+	}
+}
+
+func TestRemote_FetchRPSCancel(t *testing.T) {
+	remote := &Remote{
+		Logger:   helmexec.NewLogger(io.Discard, "debug"),
+		Home:     t.TempDir(),
+		FetchRPS: 0.001,
+		Getter: getterFunc(func(ctx context.Context, wd, src, dst string) error {
+			return os.MkdirAll(dst, 0755)
+		}),
+		fs: filesystem.DefaultFileSystem(),
+	}
+
+	// Take the only token
+	if _, err := remote.Fetch("git::https://github.com/helmfile/helmfile.git@values.yaml?ref=v1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := remote.FetchContext(ctx, "git::https://github.com/helmfile/helmfile.git@values.yaml?ref=v2")
+	if err == nil {
+		t.Fatalf("expected the throttled fetch to give up before its deadline")
+	}
+}
@@ -2,18 +2,35 @@ package remote
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
 	neturl "net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/go-getter/helper/url"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
+	"github.com/helmfile/helmfile/pkg/app/version"
 	"github.com/helmfile/helmfile/pkg/envvar"
 	"github.com/helmfile/helmfile/pkg/filesystem"
 )
@@ -24,11 +41,19 @@ func init() {
 	disableInsecureFeatures, _ = strconv.ParseBool(os.Getenv(envvar.DisableInsecureFeatures))
 }
 
+// CacheDir returns the directory in which remote files are cached.
+// It is, in order of precedence, the value of HELMFILE_CACHE_HOME, $XDG_CACHE_HOME/helmfile,
+// the helmfile directory in the user cache directory, or .helmfile when the user cache directory is unknown.
+// XDG_CACHE_HOME is honored on every platform, not only on those where os.UserCacheDir reads it.
 func CacheDir() string {
 	if h := os.Getenv(envvar.CacheHome); h != "" {
 		return h
 	}
 
+	if h := os.Getenv("XDG_CACHE_HOME"); h != "" {
+		return filepath.Join(h, "helmfile")
+	}
+
 	dir, err := os.UserCacheDir()
 	if err != nil {
 		// fall back to relative path with hidden directory
@@ -38,14 +63,104 @@ func CacheDir() string {
 }
 
 type Remote struct {
+	// Logger is used to log what Fetch does. If nil, nothing is logged.
 	Logger *zap.SugaredLogger
 
 	// Home is the directory in which remote downloads files. If empty, user cache directory is used
 	Home string
 
+	// CacheMaxAge is how long a cached remote directory is used before it gets downloaded again.
+	// Zero means that cached directories never expire.
+	CacheMaxAge time.Duration
+
+	// Namespace, if set, is the subdirectory of Home that holds the cache entries, e.g. the name of a project.
+	// Projects sharing Home but not the Namespace keep separate entries for the same source, and CleanCache and ListCache
+	// only consider those of the Namespace. It may only contain letters, digits, `.`, `_` and `-`.
+	Namespace string
+
+	// MaxCacheSize is the number of bytes the cache may take after Fetch downloads a remote directory.
+	// Over it, the least recently used cache entries are removed. Zero means no limit.
+	MaxCacheSize int64
+
+	// CacheStore, if set, is consulted before downloading a directory missing from the cache under Home,
+	// and is given the directories Fetch downloads
+	CacheStore CacheStore
+
+	// ContentAddressed makes Fetch store downloaded directories under Home/cas/<sha256 of the content>,
+	// with the cache entry of the source being a symlink to it, so that identical content fetched from different sources is stored once.
+	ContentAddressed bool
+
+	// CacheWarnAge makes Fetch warn when it serves a cached directory fetched longer ago than that, without refreshing it.
+	// Zero disables the warning.
+	CacheWarnAge time.Duration
+
+	// ForceRefresh makes Fetch ignore any cached directory and download the remote directory again
+	ForceRefresh bool
+
+	// NoCache makes Fetch download each remote directory into a new temporary directory, bypassing the cache under Home.
+	// The temporary directories are removed by Close.
+	NoCache bool
+
+	// Offline makes Fetch serve remote directories from the cache only, and fail instead of downloading missing ones.
+	// Cached directories are never expired nor refreshed in offline mode.
+	Offline bool
+
+	// KeepFailedDownloads makes Fetch keep what a failed download left in <cache entry>.failed for inspection,
+	// instead of removing it. Only the last failed download of each entry is kept.
+	KeepFailedDownloads bool
+
+	// AllowList restricts the sources Fetch accepts to those whose scheme, and getter if any, are all listed,
+	// e.g. []string{"https", "s3"} accepts https:// and s3::https:// but refuses git::https:// and file://.
+	// An empty AllowList accepts any source.
+	AllowList []string
+
+	// Timeout bounds each Fetch as a whole, from waiting for the cache lock to the end of the download.
+	// A Fetch that runs out of time fails with an error wrapping context.DeadlineExceeded, leaving no partial cache entry behind.
+	// Zero means no timeout other than the deadline of the context passed to FetchContext, if any.
+	Timeout time.Duration
+
+	// StrictEnvExpansion makes Fetch fail on sources with ${NAME} references to environment variables that are not set,
+	// instead of leaving the references as they are.
+	StrictEnvExpansion bool
+
+	// AllowedHosts restricts the hosts Fetch contacts to those matching any of the patterns, as in path.Match, where `*` also matches dots,
+	// e.g. []string{"registry.example.com", "*.mirror.example.com"}. Hosts are compared case-insensitively.
+	// file:// sources have no host and are always accepted. An empty AllowedHosts accepts any host.
+	AllowedHosts []string
+
+	// ConnectRetries is how many times Fetch retries a download that failed to connect to the remote, e.g. on a DNS lookup.
+	// Errors the remote answered with, like RemoteNotFoundError, are never retried. Zero disables retries.
+	ConnectRetries int
+
+	// ConnectRetryDelay is how long Fetch waits before the first retry of a download that failed to connect.
+	// The delay doubles with each retry. Zero means defaultConnectRetryDelay.
+	ConnectRetryDelay time.Duration
+
+	// FetchConcurrency is the maximum number of remote directories FetchAll downloads at once.
+	// Zero or less means defaultFetchConcurrency.
+	FetchConcurrency int
+
+	// FetchRPS is the maximum number of downloads started per second, shared by all the getters and concurrent fetches of the remote.
+	// Each retry counts as a download, while copies from the CacheStore don't. Zero means no limit.
+	FetchRPS float64
+
+	// Metrics is notified of cache hits and downloads, if set
+	Metrics Metrics
+
 	// Getter is the underlying implementation of getter used for fetching remote files
 	Getter Getter
 
+	// getters are used instead of Getter for the schemes they are registered for
+	getters map[string]Getter
+
+	// limiter throttles the downloads to FetchRPS. It is created on the first download.
+	limiter   *rate.Limiter
+	limiterMu sync.Mutex
+
+	// tempDirs are the temporary directories Fetch downloaded into in NoCache mode, to be removed by Close
+	tempDirs   []string
+	tempDirsMu sync.Mutex
+
 	// Filesystem abstraction
 	// Inject any implementation of your choice, like an im-memory impl for testing, os.ReadFile for the real-world use.
 	fs *filesystem.FileSystem
@@ -55,10 +170,15 @@ type Remote struct {
 // If the argument was an URL, it fetches the remote directory contained within the URL,
 // and returns the path to the file in the fetched directory
 func (r *Remote) Locate(urlOrPath string, cacheDirOpt ...string) (string, error) {
+	return r.LocateContext(context.Background(), urlOrPath, cacheDirOpt...)
+}
+
+// LocateContext is like Locate, but cancels the fetch when ctx is done
+func (r *Remote) LocateContext(ctx context.Context, urlOrPath string, cacheDirOpt ...string) (string, error) {
 	if r.fs.FileExistsAt(urlOrPath) || r.fs.DirectoryExistsAt(urlOrPath) {
 		return urlOrPath, nil
 	}
-	fetched, err := r.Fetch(urlOrPath, cacheDirOpt...)
+	fetched, err := r.FetchContext(ctx, urlOrPath, cacheDirOpt...)
 	if err != nil {
 		if _, ok := err.(InvalidURLError); ok {
 			return urlOrPath, nil
@@ -68,6 +188,28 @@ func (r *Remote) Locate(urlOrPath string, cacheDirOpt ...string) (string, error)
 	return fetched, nil
 }
 
+// CachePath tells where Locate would find the file, without downloading anything nor accessing the cache.
+// Like Locate, it returns paths to local files and invalid URLs as-is.
+func (r *Remote) CachePath(urlOrPath string, cacheDirOpt ...string) (string, error) {
+	if r.fs.FileExistsAt(urlOrPath) || r.fs.DirectoryExistsAt(urlOrPath) {
+		return urlOrPath, nil
+	}
+	t, err := r.resolve(urlOrPath, cacheDirOpt)
+	if err != nil {
+		if _, ok := err.(InvalidURLError); ok {
+			return urlOrPath, nil
+		}
+		return "", err
+	}
+	if t.localPath != "" {
+		return t.localPath, nil
+	}
+	if r.NoCache {
+		return "", fmt.Errorf("%s has no cache path: the cache is disabled, so it is downloaded to a new temporary directory each time", t.srcDir)
+	}
+	return t.path(t.cacheDirPath), nil
+}
+
 type InvalidURLError struct {
 	err string
 }
@@ -77,22 +219,90 @@ func (e InvalidURLError) Error() string {
 }
 
 type Source struct {
-	Getter, Scheme, User, Host, Dir, File, RawQuery string
+	Getter, Scheme, User, Host, Port, Dir, File, RawQuery string
+}
+
+// HostPort returns the host along with the port, if any, as it appeared in the source.
+// IPv6 literal hosts are enclosed in brackets.
+func (s *Source) HostPort() string {
+	if s.Port != "" {
+		return net.JoinHostPort(s.Host, s.Port)
+	}
+	if strings.Contains(s.Host, ":") {
+		return "[" + s.Host + "]"
+	}
+	return s.Host
 }
 
 func IsRemote(goGetterSrc string) bool {
-	if _, err := Parse(goGetterSrc); err != nil {
+	expanded, _ := expandEnv(goGetterSrc)
+	if _, err := Parse(expanded); err != nil {
 		return false
 	}
 	return true
 }
 
+// envRefRegexp matches the ${NAME} references to environment variables that expandEnv replaces
+var envRefRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} references in the source with the values of the environment variables that are set,
+// and returns the names of those that are not set, which are left as is.
+// Any other `$`, like in a password or a `$var` reference, is kept literally, so that sources that were valid before keep working.
+func expandEnv(goGetterSrc string) (string, []string) {
+	var undefined []string
+
+	expanded := envRefRegexp.ReplaceAllStringFunc(goGetterSrc, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+			return ref
+		}
+		return v
+	})
+
+	return expanded, undefined
+}
+
+// gitHostShorthands are the hosts whose scheme-less sources, like github.com/org/repo//dir@file, Parse reads as git repositories over https
+var gitHostShorthands = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// expandShorthand turns a scheme-less source on one of gitHostShorthands into the equivalent git:: source,
+// the same way go-getter's detectors do. Any other source is returned as is.
+func expandShorthand(goGetterSrc string) string {
+	for _, host := range gitHostShorthands {
+		rest, ok := strings.CutPrefix(goGetterSrc, host+"/")
+		if !ok {
+			continue
+		}
+
+		// The repository ends where the subdirectory, the file or the query begins
+		end := len(rest)
+		for _, sep := range []string{"//", "@", "?"} {
+			if i := strings.Index(rest, sep); i >= 0 && i < end {
+				end = i
+			}
+		}
+
+		repo := rest[:end]
+		if !strings.HasSuffix(repo, ".git") {
+			repo += ".git"
+		}
+
+		return "git::https://" + host + "/" + repo + rest[end:]
+	}
+
+	return goGetterSrc
+}
+
 func Parse(goGetterSrc string) (*Source, error) {
-	items := strings.Split(goGetterSrc, "::")
+	goGetterSrc = expandShorthand(goGetterSrc)
+
 	var getter string
-	if len(items) == 2 {
-		getter = items[0]
-		goGetterSrc = items[1]
+	// The getter prefix precedes the scheme. Any other `::` is part of the URL, e.g. an IPv6 host like [2001:db8::1]
+	if prefix, rest, ok := strings.Cut(goGetterSrc, "::"); ok && !strings.Contains(prefix, "/") {
+		getter = prefix
+		goGetterSrc = rest
 	}
 
 	u, err := url.Parse(goGetterSrc)
@@ -104,158 +314,1465 @@ func Parse(goGetterSrc string) (*Source, error) {
 		return nil, InvalidURLError{err: fmt.Sprintf("parse url: missing scheme - probably this is a local file path? %s", goGetterSrc)}
 	}
 
+	if u.Scheme == "file" {
+		if u.Host != "" {
+			return nil, fmt.Errorf("invalid file url: it must be `file:///<path/to/file>` without a host: got %s", goGetterSrc)
+		}
+		// The file is local, so there is no directory to fetch and the path needs no `@`.
+		// A forced getter, like git::file://, still fetches a directory.
+		if getter == "" && !strings.Contains(u.Path, "@") {
+			return &Source{
+				Getter:   getter,
+				Scheme:   u.Scheme,
+				Dir:      path.Dir(u.Path),
+				File:     path.Base(u.Path),
+				RawQuery: u.RawQuery,
+			}, nil
+		}
+	}
+
 	pathComponents := strings.Split(u.Path, "@")
+	if len(pathComponents) == 1 {
+		// go-getter's subdirectory form, <path/to/dir>//<path/to/file>, selects the file within the downloaded directory
+		if dir, file, ok := strings.Cut(u.Path, "//"); ok && dir != "" && strings.Trim(file, "/") != "" {
+			pathComponents = []string{dir, file}
+		}
+	}
 	if len(pathComponents) != 2 {
 		return nil, fmt.Errorf("invalid src format: it must be `[<getter>::]<scheme>://<host>/<path/to/dir>@<path/to/file>?key1=val1&key2=val2: got %s", goGetterSrc)
 	}
 
+	// https://host/dir/@file and https://host/dir@file refer to the same directory, so they share the cache entry
+	dir := pathComponents[0]
+	for len(dir) > 1 && strings.HasSuffix(dir, "/") {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
 	return &Source{
 		Getter:   getter,
 		User:     u.User.String(),
 		Scheme:   u.Scheme,
-		Host:     u.Host,
-		Dir:      pathComponents[0],
+		Host:     u.Hostname(),
+		Port:     u.Port(),
+		Dir:      dir,
 		File:     pathComponents[1],
 		RawQuery: u.RawQuery,
 	}, nil
 }
 
+// cacheKeyRegexp matches the cache keys that can be set with the cachekey query parameter.
+// They become directory names, which helmfile globs, so they are kept free of path separators and glob characters.
+var cacheKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// headerQueryParams maps the query parameters that Fetch sends as request headers rather than in the URL to the header they become.
+// They carry credentials, so they are also left out of the cache key and the logs.
+var headerQueryParams = map[string]func(v string) (key, value string){
+	"token": func(v string) (string, string) { return "Authorization", "Bearer " + v },
+}
+
+// cacheKeyHashLen is the number of hex digits of the source hash that end a cache key
+const cacheKeyHashLen = 12
+
+// FetchResult describes the outcome of fetching a remote file
+type FetchResult struct {
+	// Path is the path to the file in the fetched directory
+	Path string
+
+	// CacheHit is true when the remote directory was served from the cache without downloading it
+	CacheHit bool
+
+	// CacheKey is the path of the cache entry relative to the remote's Home.
+	// It is empty for file:// sources, which are read in place.
+	CacheKey string
+
+	// ResolvedSource is the source that was or would have been passed to the getter, with credentials redacted
+	ResolvedSource string
+}
+
 func (r *Remote) Fetch(goGetterSrc string, cacheDirOpt ...string) (string, error) {
-	u, err := Parse(goGetterSrc)
+	return r.FetchContext(context.Background(), goGetterSrc, cacheDirOpt...)
+}
+
+// FetchContext is like Fetch, but passes ctx down to the getter so that the download can be cancelled
+func (r *Remote) FetchContext(ctx context.Context, goGetterSrc string, cacheDirOpt ...string) (string, error) {
+	res, err := r.FetchWithResult(ctx, goGetterSrc, cacheDirOpt...)
 	if err != nil {
 		return "", err
 	}
+	return res.Path, nil
+}
 
-	srcDir := fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Dir)
-	file := u.File
+// FetchMatches is like Fetch, but the file part of the source may be a glob pattern, as in `@*.yaml`.
+// The pattern is matched relative to the fetched directory only, and it returns the sorted paths of the regular files it matches.
+// Matches that are symlinks to outside of the cache are skipped, so that a planted symlink can't be read through a pattern.
+// A file part that exists as it is is returned as it is, even when it contains pattern characters.
+func (r *Remote) FetchMatches(goGetterSrc string, cacheDirOpt ...string) ([]string, error) {
+	t, err := r.resolve(goGetterSrc, cacheDirOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.fetch(context.Background(), t)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(res.Path); err == nil && info.Mode().IsRegular() {
+		return []string{res.Path}, nil
+	}
+
+	file := t.file
+	if t.localPath != "" {
+		file = t.source.File
+	}
+
+	if !isGlob(file) {
+		return nil, nil
+	}
+
+	pattern := strings.TrimPrefix(path.Clean(filepath.ToSlash(file)), "/")
+	if !fs.ValidPath(pattern) {
+		return nil, fmt.Errorf("invalid file pattern %q in %s: it must be within the fetched directory", file, t.srcDir)
+	}
+
+	dir := strings.TrimSuffix(res.Path, string(filepath.Separator)+filepath.FromSlash(pattern))
+	if dir == res.Path {
+		return nil, fmt.Errorf("unable to find the directory %s was fetched into", t.srcDir)
+	}
+
+	matches, err := fs.Glob(os.DirFS(dir), pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file pattern %q in %s: %w", file, t.srcDir, err)
+	}
+	sort.Strings(matches)
+
+	// Files of file:// sources are the user's own, and are read in place like any local file
+	root := r.Home
+	if t.localPath != "" {
+		root = ""
+	} else if r.NoCache {
+		root = dir
+	}
+
+	var files []string
+	for _, m := range matches {
+		match := filepath.Join(dir, filepath.FromSlash(m))
+
+		if root != "" {
+			if err := checkSymlinksWithinDir(root, match); err != nil {
+				t.logger.Warnf("remote> skipping %s: %v", match, err)
+				continue
+			}
+		}
+
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			files = append(files, match)
+		}
+	}
+
+	return files, nil
+}
+
+// isGlob tells whether the file part of a source is a glob pattern rather than the path of a file
+func isGlob(file string) bool {
+	return strings.ContainsAny(file, "*?[")
+}
+
+// isLocal tells whether the source is a local file that is read in place.
+// file:// sources fetched by a forced getter, like git::file://, or pointing at an archive are fetched like any other source.
+func isLocal(u *Source) bool {
+	if u.Scheme != "file" || u.Getter != "" {
+		return false
+	}
+
+	if q, _ := neturl.ParseQuery(u.RawQuery); q.Has("archive") {
+		return false
+	}
+
+	for ext := range getter.Decompressors {
+		if strings.HasSuffix(u.Dir, "."+ext) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FetchPlan describes what Fetch would do for a remote file, as returned by Plan
+type FetchPlan struct {
+	// Path is the path the file would have in the fetched directory
+	Path string
+
+	// Download is true when the remote directory would be downloaded rather than served from the cache
+	Download bool
 
-	r.Logger.Debugf("remote> getter: %s", u.Getter)
-	r.Logger.Debugf("remote> scheme: %s", u.Scheme)
-	r.Logger.Debugf("remote> user: %s", u.User)
-	r.Logger.Debugf("remote> host: %s", u.Host)
-	r.Logger.Debugf("remote> dir: %s", u.Dir)
-	r.Logger.Debugf("remote> file: %s", u.File)
+	// CacheKey is the path of the cache entry relative to the remote's Home
+	CacheKey string
+
+	// ResolvedSource is the source that would be passed to the getter, with credentials redacted
+	ResolvedSource string
+}
+
+// fetchTarget is a parsed source along with the cache entry it is fetched into
+type fetchTarget struct {
+	source *Source
+
+	// srcDir is the remote directory, without the getter, credentials and query
+	srcDir string
+
+	// query is the query passed to the getter. It lacks the checksum, which is verified by Fetch.
+	query    string
+	checksum string
+
+	// header holds the request headers made of the query parameters listed in headerQueryParams
+	header http.Header
+
+	// filename is the name Fetch gives the file in place of its own, from the filename query parameter
+	filename string
+
+	// getterDst is the path of the cache entry relative to the remote's Home
+	getterDst string
+
+	// file is the path of the file in the cache entry. It differs from the file of the source when go-getter decompresses it.
+	file string
+
+	cacheDirPath string
+
+	// localPath is the path to the file of a file:// source, which is read in place rather than fetched
+	localPath string
+
+	// logger is the remote's logger with the fields identifying the source attached
+	logger *zap.SugaredLogger
+}
+
+// resolve parses the source and computes the cache entry it is fetched into, without accessing the network nor the cache
+func (r *Remote) resolve(goGetterSrc string, cacheDirOpt []string) (*fetchTarget, error) {
+	expanded, undefined := expandEnv(goGetterSrc)
+
+	u, err := Parse(expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked after parsing, so that a local path containing `$` is still reported as an InvalidURLError
+	if r.StrictEnvExpansion && len(undefined) > 0 {
+		return nil, fmt.Errorf("undefined environment variables in remote source %s: %s", goGetterSrc, strings.Join(undefined, ", "))
+	}
+
+	if err := r.checkAllowed(u); err != nil {
+		return nil, err
+	}
+
+	if err := r.checkAllowedHost(u); err != nil {
+		return nil, err
+	}
+
+	srcDir := fmt.Sprintf("%s://%s%s", u.Scheme, u.HostPort(), u.Dir)
+
+	if isLocal(u) {
+		localPath := filepath.Join(filepath.FromSlash(u.Dir), filepath.FromSlash(u.File))
+
+		logger := r.logger().With("scheme", u.Scheme)
+		logger.Debugf("remote> local file: %s", localPath)
+
+		return &fetchTarget{source: u, srcDir: srcDir, localPath: localPath, logger: logger}, nil
+	}
 
 	// This should be shared across variant commands, so that they can share cache for the shared imports
 	cacheBaseDir := ""
 	if len(cacheDirOpt) == 1 {
 		cacheBaseDir = cacheDirOpt[0]
 	} else if len(cacheDirOpt) > 0 {
-		return "", fmt.Errorf("[bug] cacheDirOpt's length: want 0 or 1, got %d", len(cacheDirOpt))
+		return nil, fmt.Errorf("[bug] cacheDirOpt's length: want 0 or 1, got %d", len(cacheDirOpt))
 	}
 
 	query := u.RawQuery
 
+	var (
+		checksum, cacheKeyOverride, filename string
+		header                               http.Header
+	)
+	if len(query) > 0 {
+		q, _ := neturl.ParseQuery(query)
+		if q.Has("checksum") {
+			// go-getter refuses checksums for directory downloads, so we verify the file ourselves
+			checksum = q.Get("checksum")
+			query = removeQueryParam(query, "checksum")
+		}
+		if q.Has("cachekey") {
+			cacheKeyOverride = q.Get("cachekey")
+			if !cacheKeyRegexp.MatchString(cacheKeyOverride) || strings.Trim(cacheKeyOverride, ".") == "" {
+				return nil, fmt.Errorf("invalid cachekey %q: it must consist of letters, digits, `.`, `_` and `-` only, and not of dots only", cacheKeyOverride)
+			}
+			// The content store and the files next to the entries would be taken for the entry, or the other way around
+			if cacheKeyOverride == contentStoreDir || IsCacheSidecar(cacheKeyOverride) {
+				return nil, fmt.Errorf("invalid cachekey %q: it is reserved for the cache's own use", cacheKeyOverride)
+			}
+			query = removeQueryParam(query, "cachekey")
+		}
+		if q.Has("filename") {
+			filename = q.Get("filename")
+			if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+				return nil, fmt.Errorf("invalid filename %q: it must be a file name without directories", filename)
+			}
+			query = removeQueryParam(query, "filename")
+			if _, ok := r.getterFor(u).(FileGetter); !ok || !isSingleFile(u, query) {
+				return nil, fmt.Errorf("the filename parameter of %s is only supported for files downloaded alone, like those of http(s) sources", getterSource(u, "", true))
+			}
+		}
+		for param, toHeader := range headerQueryParams {
+			if !q.Has(param) {
+				continue
+			}
+			if (u.Scheme != "http" && u.Scheme != "https") || (u.Getter != "" && u.Getter != "http" && u.Getter != "https" && u.Getter != httpListingGetterName) {
+				return nil, fmt.Errorf("the %s parameter of %s is only supported for http(s) sources downloaded by the http or %s getter", param, getterSource(u, "", true), httpListingGetterName)
+			}
+			if header == nil {
+				header = http.Header{}
+			}
+			header.Set(toHeader(q.Get(param)))
+			query = removeQueryParam(query, param)
+		}
+	}
+
+	// The cache key leaves credentials out, so that the entry doesn't change when they are rotated,
+	// while the getter still receives them through getterSource
 	var cacheKey string
-	replacer := strings.NewReplacer(":", "", "//", "_", "/", "_", ".", "_")
+	// Brackets around IPv6 hosts are dropped as helmfile globs the paths of values files
+	replacer := strings.NewReplacer(":", "", "//", "_", "/", "_", ".", "_", "[", "", "]", "")
 	dirKey := replacer.Replace(srcDir)
+	var paramsKey string
 	if len(query) > 0 {
 		q, _ := neturl.ParseQuery(query)
 		if q.Has("sshkey") {
 			q.Set("sshkey", "redacted")
 		}
-		paramsKey := strings.ReplaceAll(q.Encode(), "&", "_")
-		cacheKey = fmt.Sprintf("%s.%s", dirKey, paramsKey)
+		paramsKey = q.Encode()
+		cacheKey = fmt.Sprintf("%s.%s", dirKey, strings.ReplaceAll(paramsKey, "&", "_"))
 	} else {
 		cacheKey = dirKey
 	}
+	// The replacer maps distinct sources like a.b/c and a/b.c to the same key, so a hash of the source keeps them apart
+	sum := sha256.Sum256([]byte(u.Getter + "::" + srcDir + "?" + paramsKey))
+	cacheKey = fmt.Sprintf("%s-%s", cacheKey, hex.EncodeToString(sum[:])[:cacheKeyHashLen])
+
+	// Sources with the same cachekey share their cache entry, whatever their URLs
+	if cacheKeyOverride != "" {
+		cacheKey = cacheKeyOverride
+	}
 
-	cached := false
+	if err := r.checkNamespace(); err != nil {
+		return nil, err
+	}
 
-	// e.g. https_github_com_cloudposse_helmfiles_git.ref=0.xx.0
-	getterDst := filepath.Join(cacheBaseDir, cacheKey)
+	// e.g. https_github_com_cloudposse_helmfiles_git.ref=0.xx.0-0123456789ab
+	getterDst := filepath.Join(r.Namespace, cacheBaseDir, cacheKey)
 
-	// e.g. os.CacheDir()/helmfile/https_github_com_cloudposse_helmfiles_git.ref=0.xx.0
+	// e.g. os.CacheDir()/helmfile/https_github_com_cloudposse_helmfiles_git.ref=0.xx.0-0123456789ab
 	cacheDirPath := filepath.Join(r.Home, getterDst)
 
-	r.Logger.Debugf("remote> home: %s", r.Home)
-	r.Logger.Debugf("remote> getter dest: %s", getterDst)
-	r.Logger.Debugf("remote> cached dir: %s", cacheDirPath)
+	if err := checkWithinDir(r.Home, cacheDirPath); err != nil {
+		return nil, err
+	}
 
-	{
-		if r.fs.FileExistsAt(cacheDirPath) {
-			return "", fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", getterDst)
-		}
+	// Fields let structured log backends filter the lines of a fetch by host or cache entry
+	logger := r.logger().With("scheme", u.Scheme, "host", u.Host, "cacheKey", getterDst)
+	if u.Getter != "" {
+		logger = logger.With("getter", u.Getter)
+	}
 
-		if r.fs.DirectoryExistsAt(cacheDirPath) {
-			cached = true
-		}
+	// The user info may hold a password, possibly from an expanded environment variable, so it is never logged
+	logger.Debugw(fmt.Sprintf("remote> resolved %s to %s", getterSource(u, query, true), cacheDirPath),
+		"port", u.Port,
+		"dir", u.Dir,
+		"file", u.File,
+		"home", r.Home,
+	)
+
+	file := u.File
+	if _, ok := r.getterFor(u).(FileGetter); ok && isSingleFile(u, query) && isGzipFile(u.File) {
+		// go-getter decompresses single .gz files as it downloads them
+		file = strings.TrimSuffix(u.File, ".gz")
 	}
 
-	if !cached {
-		var getterSrc string
-		if u.User != "" {
-			getterSrc = fmt.Sprintf("%s://%s@%s%s", u.Scheme, u.User, u.Host, u.Dir)
-		} else {
-			getterSrc = fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Dir)
-		}
+	return &fetchTarget{
+		source:       u,
+		srcDir:       srcDir,
+		query:        query,
+		checksum:     checksum,
+		header:       header,
+		filename:     filename,
+		getterDst:    getterDst,
+		file:         file,
+		cacheDirPath: cacheDirPath,
+		logger:       logger,
+	}, nil
+}
 
-		if len(query) > 0 {
-			getterSrc = strings.Join([]string{getterSrc, query}, "?")
-		}
+// checkNamespace returns an error when r.Namespace isn't a plain directory name distinct from the content store's
+func (r *Remote) checkNamespace() error {
+	if r.Namespace == "" {
+		return nil
+	}
+	if !cacheKeyRegexp.MatchString(r.Namespace) || strings.Trim(r.Namespace, ".") == "" || r.Namespace == contentStoreDir {
+		return fmt.Errorf("invalid cache namespace %q: it must consist of letters, digits, `.`, `_` and `-` only, and be neither %q nor of dots only", r.Namespace, contentStoreDir)
+	}
+	return nil
+}
 
-		if u.Getter != "" {
-			getterSrc = u.Getter + "::" + getterSrc
-		}
+// cacheHome returns the directory holding the cache entries of r.Namespace
+func (r *Remote) cacheHome() string {
+	return filepath.Join(r.Home, r.Namespace)
+}
 
-		r.Logger.Debugf("remote> downloading %s to %s", getterSrc, getterDst)
+// cached tells whether Fetch would serve the target from its cache entry rather than downloading it
+func (r *Remote) cached(t *fetchTarget) (bool, error) {
+	if r.fs.FileExistsAt(t.cacheDirPath) {
+		return false, fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", t.getterDst)
+	}
 
-		if err := r.Getter.Get(r.Home, getterSrc, cacheDirPath); err != nil {
-			rmerr := os.RemoveAll(cacheDirPath)
-			if rmerr != nil {
-				return "", multierr.Append(err, rmerr)
-			}
-			return "", err
-		}
+	if !r.fs.DirectoryExistsAt(t.cacheDirPath) {
+		return false, nil
 	}
 
-	return filepath.Join(cacheDirPath, file), nil
-}
+	switch {
+	case r.Offline:
+		// Never throw away what may be the only copy we can get
+		return true, nil
+	case r.ForceRefresh:
+		t.logger.Debugf("remote> refreshing cached dir: %s", t.cacheDirPath)
+		return false, nil
+	case r.cacheExpired(t.cacheDirPath):
+		t.logger.Debugf("remote> cache expired: %s", t.cacheDirPath)
+		return false, nil
+	case !r.cacheEntryComplete(t):
+		t.logger.Warnf("remote> the cache entry %s is empty or lacks a non-empty %s: downloading it again", t.cacheDirPath, t.file)
+		return false, nil
+	}
 
-type Getter interface {
-	Get(wd, src, dst string) error
+	return true, nil
 }
 
-type GoGetter struct {
-	Logger *zap.SugaredLogger
+// cacheEntryComplete tells whether the cache entry of the target holds the file to fetch,
+// so that an entry left empty or truncated, e.g. by a disk full or a manual cleanup, is downloaded again
+// rather than Fetch returning the path to a file that doesn't exist or is empty.
+// Glob patterns may legitimately match nothing, so only the entry being empty is checked for them.
+func (r *Remote) cacheEntryComplete(t *fetchTarget) bool {
+	if entries, err := r.fs.ReadDir(t.cacheDirPath); err == nil && len(entries) == 0 {
+		return false
+	}
+
+	if t.file == "" || isGlob(t.file) {
+		return true
+	}
+
+	p := filepath.Join(t.cacheDirPath, t.file)
+
+	if r.fs.DirectoryExistsAt(p) {
+		return true
+	}
+	if !r.fs.FileExistsAt(p) {
+		return false
+	}
+
+	// An empty file is what an interrupted copy or download leaves behind
+	if info, err := r.fs.Stat(p); err == nil && info.Mode().IsRegular() && info.Size() == 0 {
+		return false
+	}
+
+	return true
 }
 
-func (g *GoGetter) Get(wd, src, dst string) error {
-	ctx := context.Background()
+// Plan tells what Fetch would do for the remote file, without downloading anything nor modifying the cache
+func (r *Remote) Plan(goGetterSrc string, cacheDirOpt ...string) (*FetchPlan, error) {
+	t, err := r.resolve(goGetterSrc, cacheDirOpt)
+	if err != nil {
+		return nil, err
+	}
 
-	get := &getter.Client{
-		Ctx:     ctx,
-		Src:     src,
-		Dst:     dst,
-		Pwd:     wd,
-		Mode:    getter.ClientModeDir,
-		Options: []getter.ClientOption{},
+	if t.localPath != "" {
+		return &FetchPlan{Path: t.localPath, ResolvedSource: t.srcDir}, nil
 	}
 
-	g.Logger.Debugf("client: %+v", *get)
+	if r.NoCache {
+		return &FetchPlan{Download: true, ResolvedSource: getterSource(t.source, t.query, true)}, nil
+	}
 
-	if err := get.Get(); err != nil {
-		return fmt.Errorf("get: %v", err)
+	cached, err := r.cached(t)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if !cached && r.Offline {
+		return nil, fmt.Errorf("%s is not cached and remote fetching is disabled in offline mode: populate the cache entry %s first", t.srcDir, t.getterDst)
+	}
+
+	return &FetchPlan{
+		Path:           t.path(t.cacheDirPath),
+		Download:       !cached,
+		CacheKey:       t.getterDst,
+		ResolvedSource: getterSource(t.source, t.query, true),
+	}, nil
 }
 
-func NewRemote(logger *zap.SugaredLogger, homeDir string, fs *filesystem.FileSystem) *Remote {
-	if disableInsecureFeatures {
-		panic("Remote sources are disabled due to 'DISABLE_INSECURE_FEATURES'")
+// FetchWithResult is like FetchContext, but also tells where the file came from
+func (r *Remote) FetchWithResult(ctx context.Context, goGetterSrc string, cacheDirOpt ...string) (*FetchResult, error) {
+	t, err := r.resolve(goGetterSrc, cacheDirOpt)
+	if err != nil {
+		return nil, err
 	}
-	remote := &Remote{
-		Logger: logger,
-		Home:   homeDir,
-		Getter: &GoGetter{Logger: logger},
-		fs:     fs,
+
+	return r.fetch(ctx, t)
+}
+
+// fetch fetches the resolved target, unless it is already cached
+func (r *Remote) fetch(ctx context.Context, t *fetchTarget) (*FetchResult, error) {
+	if t.localPath != "" {
+		return &FetchResult{Path: t.localPath, ResolvedSource: t.srcDir}, nil
 	}
 
-	if remote.Home == "" {
-		// Use for remote charts
-		remote.Home = CacheDir()
+	u, query, cacheDirPath, getterDst := t.source, t.query, t.cacheDirPath, t.getterDst
+
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	if t.header != nil {
+		ctx = context.WithValue(ctx, requestHeaderKey{}, t.header)
+	}
+
+	if r.NoCache {
+		return r.fetchUncached(ctx, t)
+	}
+
+	unlock, err := r.lockCacheEntry(ctx, cacheDirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cached, err := r.cached(t)
+	if err != nil {
+		return nil, err
 	}
 
-	return remote
+	// Start from a clean directory so that stale or partial files don't get merged into the new download
+	stale := !cached && r.fs.DirectoryExistsAt(cacheDirPath)
+	if stale {
+		if err := removeCacheEntry(cacheDirPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// The store can stand in for the download of a directory missing from the local cache.
+	// A stale directory is downloaded again instead, so that the store gets refreshed too.
+	var storeDir string
+	if !cached && !stale && !r.ForceRefresh && r.CacheStore != nil {
+		storeDir, _ = r.CacheStore.Get(filepath.ToSlash(getterDst))
+	}
+
+	if !cached && storeDir == "" && r.Offline {
+		return nil, fmt.Errorf("%s is not cached and remote fetching is disabled in offline mode: populate the cache entry %s first", t.srcDir, getterDst)
+	}
+
+	if !cached {
+		t.logger.Debugf("remote> fetching %s into %s", getterSource(u, query, true), getterDst)
+
+		download := r.downloadFunc(ctx, t, storeDir, cacheDirPath+cachePartialSuffix)
+
+		start := time.Now()
+		err := r.populateCacheEntry(download, cacheDirPath, getterSource(u, query, true))
+		r.reportDownload(u.Scheme, time.Since(start), cacheDirPath, err)
+		if err != nil {
+			return nil, err
+		}
+
+		if storeDir == "" && r.CacheStore != nil && r.fs.DirectoryExistsAt(cacheDirPath) {
+			if err := r.CacheStore.Put(filepath.ToSlash(getterDst), cacheDirPath); err != nil {
+				t.logger.Warnf("remote> unable to put %s into the cache store: %v", getterDst, err)
+			}
+		}
+
+		r.evictCache(cacheDirPath)
+	} else {
+		r.touchCacheEntry(cacheDirPath)
+		r.warnIfStale(cacheDirPath)
+
+		if r.Metrics != nil {
+			r.Metrics.CacheHit(u.Scheme)
+		}
+	}
+
+	fetched := filepath.Join(cacheDirPath, t.file)
+
+	for _, p := range []string{cacheDirPath, fetched} {
+		if err := checkSymlinksWithinDir(r.Home, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.checksum != "" {
+		if err := verifyChecksum(fetched, t.checksum); err != nil {
+			rmerr := removeCacheEntry(cacheDirPath)
+			if rmerr != nil {
+				return nil, multierr.Append(err, rmerr)
+			}
+			return nil, err
+		}
+	}
+
+	if t.filename != "" {
+		if fetched, err = linkFile(fetched, t.path(cacheDirPath)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FetchResult{
+		Path:           fetched,
+		CacheHit:       cached,
+		CacheKey:       getterDst,
+		ResolvedSource: getterSource(u, query, true),
+	}, nil
+}
+
+// downloadFunc returns the function that downloads the target into the directory it is given.
+// The directory is copied from storeDir when set. Otherwise the source is downloaded by its getter, within the rate limit and with connection retries.
+// A single file is downloaded to partial first, so that it survives a failed attempt and the next one can resume it.
+// A download that outlives ctx fails, even if the getter ignored ctx and completed.
+func (r *Remote) downloadFunc(ctx context.Context, t *fetchTarget, storeDir, partial string) func(dst string) error {
+	u, query := t.source, t.query
+
+	if storeDir != "" {
+		t.logger.Debugf("remote> copying %s from the cache store", storeDir)
+
+		return func(dst string) error {
+			return copyDir(storeDir, dst)
+		}
+	}
+
+	get := r.getterFor(u)
+
+	download := func(dst string) error {
+		return get.Get(ctx, r.Home, getterSource(u, query, false), dst)
+	}
+
+	if fileGetter, ok := get.(FileGetter); ok && isSingleFile(u, query) {
+		// Download the file alone, to where it would be in the directory
+		fileSrc := *u
+		fileSrc.Dir = path.Join(u.Dir, u.File)
+
+		t.logger.Debugf("remote> downloading the single file %s", getterSource(&fileSrc, query, true))
+
+		download = func(dst string) error {
+			if err := fileGetter.GetFile(ctx, r.Home, getterSource(&fileSrc, query, false), partial); err != nil {
+				return err
+			}
+			if _, err := os.Stat(partial); os.IsNotExist(err) {
+				return nil
+			}
+
+			file := filepath.Join(dst, filepath.FromSlash(t.file))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			return os.Rename(partial, file)
+		}
+	}
+
+	download = r.withConnectRetries(ctx, t.logger, getterSource(u, query, true), r.withRateLimit(ctx, download))
+
+	return func(dst string) error {
+		err := download(dst)
+		if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+			// Getters often flatten the cancellation into an error message, which would hide it from errors.Is
+			err = multierr.Append(err, fmt.Errorf("downloading %s: %w", getterSource(u, query, true), ctxErr))
+		}
+		return err
+	}
+}
+
+// fetchUncached downloads the target into a new temporary directory, which Close removes
+func (r *Remote) fetchUncached(ctx context.Context, t *fetchTarget) (*FetchResult, error) {
+	u, query := t.source, t.query
+
+	if r.Offline {
+		return nil, fmt.Errorf("%s can't be fetched: remote fetching is disabled in offline mode, and the cache is disabled", t.srcDir)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "helmfile-remote-")
+	if err != nil {
+		return nil, err
+	}
+
+	r.tempDirsMu.Lock()
+	r.tempDirs = append(r.tempDirs, tmpDir)
+	r.tempDirsMu.Unlock()
+
+	// go-getter wants to create the destination by itself
+	dst := filepath.Join(tmpDir, "src")
+
+	t.logger.Debugf("remote> fetching %s into %s without caching it", getterSource(u, query, true), dst)
+
+	download := r.downloadFunc(ctx, t, "", dst+cachePartialSuffix)
+
+	start := time.Now()
+	err = download(dst)
+	r.reportDownload(u.Scheme, time.Since(start), dst, err)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := filepath.Join(dst, t.file)
+
+	if err := checkSymlinksWithinDir(tmpDir, fetched); err != nil {
+		return nil, err
+	}
+
+	if t.checksum != "" {
+		if err := verifyChecksum(fetched, t.checksum); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.filename != "" {
+		if fetched, err = linkFile(fetched, t.path(dst)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FetchResult{Path: fetched, ResolvedSource: getterSource(u, query, true)}, nil
+}
+
+// path returns the path Fetch returns for the target when it is fetched into dir
+func (t *fetchTarget) path(dir string) string {
+	if t.filename != "" {
+		return filepath.Join(dir, filepath.Dir(filepath.FromSlash(t.file)), t.filename)
+	}
+	return filepath.Join(dir, t.file)
+}
+
+// linkFile makes the file available at dst too, as a hard link or a copy when hard links aren't supported, and returns dst.
+// A dst left by a previous call is kept, as the file it was made from doesn't change for the lifetime of the cache entry.
+func linkFile(file, dst string) (string, error) {
+	if _, err := os.Lstat(dst); err == nil {
+		return dst, nil
+	}
+
+	if err := os.Link(file, dst); err != nil {
+		info, statErr := os.Stat(file)
+		if statErr != nil {
+			return "", statErr
+		}
+		if err := copyFile(file, dst, info.Mode().Perm()); err != nil {
+			return "", fmt.Errorf("making %s available as %s: %w", file, dst, err)
+		}
+	}
+
+	return dst, nil
+}
+
+// checkAllowed returns an error unless the scheme and the getter of the source are in r.AllowList, when there is one
+func (r *Remote) checkAllowed(u *Source) error {
+	if len(r.AllowList) == 0 {
+		return nil
+	}
+
+	for _, name := range []string{u.Scheme, u.Getter} {
+		if name == "" {
+			continue
+		}
+
+		allowed := false
+		for _, a := range r.AllowList {
+			if a == name {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("remote source %s://%s%s is not allowed: %q is not in %s", u.Scheme, u.HostPort(), u.Dir, name, envvar.InsecureAllowList)
+		}
+	}
+
+	return nil
+}
+
+// checkAllowedHost returns an error unless the host of the source matches r.AllowedHosts, when there are some
+func (r *Remote) checkAllowedHost(u *Source) error {
+	if len(r.AllowedHosts) == 0 || u.Scheme == "file" {
+		return nil
+	}
+
+	host := strings.ToLower(u.Host)
+
+	for _, pattern := range r.AllowedHosts {
+		matched, err := path.Match(strings.ToLower(pattern), host)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q in %s: %w", pattern, envvar.RemoteAllowedHosts, err)
+		}
+		if matched {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("remote source %s://%s%s is not allowed: host %q is not in %s", u.Scheme, u.HostPort(), u.Dir, u.Host, envvar.RemoteAllowedHosts)
+}
+
+// reportDownload notifies r.Metrics, if any, of a download into cacheDirPath that ended with err
+func (r *Remote) reportDownload(scheme string, duration time.Duration, cacheDirPath string, err error) {
+	if r.Metrics == nil {
+		return
+	}
+
+	var size int64
+	if err == nil {
+		// The getter may have downloaded nothing, in which case there is no directory to measure
+		if dir, err := filepath.EvalSymlinks(cacheDirPath); err == nil {
+			size, _ = dirSize(dir)
+		}
+	}
+
+	r.Metrics.Downloaded(scheme, duration, size, err)
+}
+
+// checkSymlinksWithinDir returns an error when path, once its symlinks are resolved, is outside of dir.
+// It keeps a symlink planted in the cache from making helmfile read any file on the machine.
+// Paths that don't exist have nothing to read, so they pass.
+func checkSymlinksWithinDir(dir, path string) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("resolving symlinks in %s: %w", path, err)
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("resolving symlinks in %s: %w", dir, err)
+	}
+
+	if err := checkWithinDir(resolvedDir, resolved); err != nil {
+		return fmt.Errorf("%s is a symlink to a path outside of the cache: %w", path, err)
+	}
+
+	return nil
+}
+
+// removeQueryParam removes the key from the raw query.
+// The other parameters are kept verbatim and in order, so that the getter sees them as the user wrote them.
+func removeQueryParam(rawQuery, key string) string {
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		k, _, _ := strings.Cut(param, "=")
+		if unescaped, err := neturl.QueryUnescape(k); err == nil && unescaped == key {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return strings.Join(kept, "&")
+}
+
+// checkWithinDir returns an error unless path is dir or a path under it.
+// It keeps crafted sources and cache subdirectories from making Fetch write outside of the cache.
+func checkWithinDir(dir, path string) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return fmt.Errorf("unable to determine whether %s is within %s: %w", path, dir, err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("%s escapes the cache directory %s", path, dir)
+	}
+	return nil
+}
+
+// getterSource builds the source passed to the getter from the parsed source and the query to send.
+// When redact is true, credentials are replaced so that the result can be logged.
+func getterSource(u *Source, query string, redact bool) string {
+	user := u.User
+	if redact && user != "" {
+		user = "redacted"
+	}
+
+	if redact && len(query) > 0 {
+		q, _ := neturl.ParseQuery(query)
+		if q.Has("sshkey") {
+			q.Set("sshkey", "redacted")
+			query = q.Encode()
+		}
+	}
+
+	var getterSrc string
+	getterName := u.Getter
+	switch {
+	case u.Scheme == "gs":
+		// go-getter has no gs:// scheme. Its GCS getter expects the JSON API URL of the bucket and
+		// authenticates with Application Default Credentials, so we translate gs://<bucket>/<dir> to it.
+		getterSrc = fmt.Sprintf("https://www.googleapis.com/storage/v1/%s%s", u.Host, u.Dir)
+		if getterName == "" {
+			getterName = "gcs"
+		}
+	case user != "":
+		getterSrc = fmt.Sprintf("%s://%s@%s%s", u.Scheme, user, u.HostPort(), u.Dir)
+	default:
+		getterSrc = fmt.Sprintf("%s://%s%s", u.Scheme, u.HostPort(), u.Dir)
+	}
+
+	if len(query) > 0 {
+		getterSrc = strings.Join([]string{getterSrc, query}, "?")
+	}
+
+	if getterName != "" {
+		getterSrc = getterName + "::" + getterSrc
+	}
+
+	return getterSrc
+}
+
+// verifyChecksum checks the file against a checksum of the form <type>:<hex>, e.g. sha256:abcd...
+func verifyChecksum(path, checksum string) error {
+	typ, want, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return fmt.Errorf("invalid checksum %q: it must be `<type>:<value>`", checksum)
+	}
+
+	var h hash.Hash
+	switch typ {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported checksum type %q: it must be sha256 or sha512", typ)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("verifying checksum: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("verifying checksum of %s: %w", path, err)
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s:%s, got %s:%s", path, typ, want, typ, got)
+	}
+
+	return nil
+}
+
+type Getter interface {
+	Get(ctx context.Context, wd, src, dst string) error
+}
+
+// isSingleFile returns true when the source is a single file that can be downloaded without its directory.
+// That's the case for files served over plain http(s), whose directories go-getter can't list.
+// Archives, globs and sources forced to a getter are still downloaded as directories.
+func isSingleFile(u *Source, query string) bool {
+	if u.Getter != "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	if u.File == "" || isGlob(u.File) {
+		return false
+	}
+
+	if q, _ := neturl.ParseQuery(query); q.Has("archive") {
+		return false
+	}
+
+	for ext := range getter.Decompressors {
+		if strings.HasSuffix(u.Dir, "."+ext) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isGzipFile tells whether the file is gzipped by itself, rather than being a gzipped tarball that holds a directory
+func isGzipFile(file string) bool {
+	return strings.HasSuffix(file, ".gz") && !strings.HasSuffix(file, ".tar.gz")
+}
+
+// getterFor returns the getter Fetch downloads the source with.
+// A getter registered for the forced getter of the source takes precedence over the one registered for its scheme.
+func (r *Remote) getterFor(u *Source) Getter {
+	if g, ok := r.getters[u.Getter]; ok && u.Getter != "" {
+		return g
+	}
+	if g, ok := r.getters[u.Scheme]; ok {
+		return g
+	}
+	return r.Getter
+}
+
+// loggerOrNop returns l, or a logger discarding everything if l is nil,
+// so that remotes and getters built without a logger can still be used
+func loggerOrNop(l *zap.SugaredLogger) *zap.SugaredLogger {
+	if l == nil {
+		return zap.NewNop().Sugar()
+	}
+	return l
+}
+
+func (r *Remote) logger() *zap.SugaredLogger {
+	return loggerOrNop(r.Logger)
+}
+
+type requestHeaderKey struct{}
+
+// RequestHeader returns the request headers Fetch made of the query parameters of the source being downloaded with ctx,
+// e.g. `Authorization: Bearer <token>` for the token parameter, or nil if there are none.
+// Getters registered for http(s) sources should send them, as the parameters are removed from the source they are given.
+func RequestHeader(ctx context.Context) http.Header {
+	h, _ := ctx.Value(requestHeaderKey{}).(http.Header)
+	return h
+}
+
+// FileGetter is implemented by getters that can download a single file rather than the directory containing it.
+// dst may hold the part of the file downloaded by a previous, interrupted call, which GetFile may resume or must overwrite.
+type FileGetter interface {
+	GetFile(ctx context.Context, wd, src, dst string) error
+}
+
+type GoGetter struct {
+	// Logger is used to log the downloads. If nil, nothing is logged.
+	Logger *zap.SugaredLogger
+
+	// ProgressListener is notified of the files downloaded by go-getter's http and s3 getters, if set
+	ProgressListener getter.ProgressTracker
+
+	// UserAgent is sent in the User-Agent header of the requests made by go-getter's http getter.
+	// If empty, Go's default is sent.
+	UserAgent string
+
+	// HTTPClient is used by go-getter's http getter instead of its default client, if set.
+	// It allows configuring timeouts, proxies, TLS and retries all at once, e.g. with a custom Transport.
+	HTTPClient *http.Client
+
+	// BearerToken is sent in the `Authorization: Bearer <token>` header of the requests made by go-getter's http getter,
+	// unless the source sets its own with the token parameter
+	BearerToken string
+
+	// HTTPTimeout limits how long each request of go-getter's http getter may take, reading the response included.
+	// It applies on top of HTTPClient. Zero means no limit.
+	HTTPTimeout time.Duration
+
+	// S3Endpoint is the endpoint of the S3-compatible store every s3 source is downloaded from, e.g. https://minio.internal:9000.
+	// If empty, s3 sources are downloaded from the host of their URL.
+	S3Endpoint string
+
+	// S3ForcePathStyle makes the requests to S3Endpoint address the bucket in the path rather than in the host, as MinIO requires
+	S3ForcePathStyle bool
+}
+
+// defaultHTTPTimeout is the HTTPTimeout of the GoGetter of NewRemote, unless HELMFILE_HTTP_TIMEOUT overrides it
+const defaultHTTPTimeout = 30 * time.Second
+
+func (g *GoGetter) Get(ctx context.Context, wd, src, dst string) error {
+	return g.get(ctx, wd, src, dst, getter.ClientModeDir)
+}
+
+// GetFile downloads the single file src to dst.
+// go-getter's http getter resumes a partial dst with a range request when the server accepts them,
+// but it writes over a partial dst from the start otherwise, without truncating it. So a partial dst that
+// can't be resumed is removed first.
+func (g *GoGetter) GetFile(ctx context.Context, wd, src, dst string) error {
+	if info, err := os.Stat(dst); err == nil && !g.resumable(ctx, src, info) {
+		loggerOrNop(g.Logger).Debugf("remote> discarding the partial download %s of %s", dst, src)
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	return g.get(ctx, wd, src, dst, getter.ClientModeFile)
+}
+
+// resumable tells whether the download of the http(s) source src can be resumed from the partial file described by partial.
+// It asks the server whether it accepts range requests, and whether the file was modified since the partial download.
+func (g *GoGetter) resumable(ctx context.Context, src string, partial os.FileInfo) bool {
+	u, err := neturl.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, src, nil)
+	if err != nil {
+		return false
+	}
+	for k, v := range g.requestHeader(RequestHeader(ctx)) {
+		req.Header[k] = v
+	}
+
+	client := g.httpClient()
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength < partial.Size() {
+		return false
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && lastModified.After(partial.ModTime()) {
+		return false
+	}
+
+	return true
+}
+
+func (g *GoGetter) get(ctx context.Context, wd, src, dst string, mode getter.ClientMode) error {
+	opts := []getter.ClientOption{}
+	if g.ProgressListener != nil {
+		opts = append(opts, getter.WithProgress(g.ProgressListener))
+	}
+
+	get := &getter.Client{
+		Ctx:     ctx,
+		Src:     src,
+		Dst:     dst,
+		Pwd:     wd,
+		Mode:    mode,
+		Options: opts,
+		Getters: g.getters(RequestHeader(ctx)),
+	}
+
+	loggerOrNop(g.Logger).Debugf("client: %+v", *get)
+
+	if err := get.Get(); err != nil {
+		return goGetterError(fmt.Errorf("get: %w", err))
+	}
+
+	return nil
+}
+
+// getters returns copies of go-getter's default getters, with the http getter using g.httpClient() and sending header along with g's own,
+// and the s3 getter replaced by s3Getter.
+// go-getter's clients set themselves on each of their getters, so concurrent downloads sharing the defaults would race.
+func (g *GoGetter) getters(header http.Header) map[string]getter.Getter {
+	getters := make(map[string]getter.Getter, len(getter.Getters))
+	for k, v := range getter.Getters {
+		getters[k] = cloneGetter(v)
+	}
+
+	httpGetter := &getter.HttpGetter{
+		Netrc:  true,
+		Client: g.httpClient(),
+	}
+	if h := g.requestHeader(header); len(h) > 0 {
+		httpGetter.Header = h
+	}
+	getters["http"] = httpGetter
+	getters["https"] = httpGetter
+
+	getters["s3"] = &s3Getter{
+		endpoint:       g.S3Endpoint,
+		forcePathStyle: g.S3ForcePathStyle,
+		fallback:       getters["s3"],
+	}
+
+	return getters
+}
+
+// httpClient returns the client of the requests to http sources, which is g.HTTPClient limited to g.HTTPTimeout.
+// It returns nil, for the caller's default client, when neither is set.
+func (g *GoGetter) httpClient() *http.Client {
+	if g.HTTPTimeout <= 0 {
+		return g.HTTPClient
+	}
+
+	client := &http.Client{}
+	if g.HTTPClient != nil {
+		c := *g.HTTPClient
+		client = &c
+	}
+	client.Timeout = g.HTTPTimeout
+
+	return client
+}
+
+// requestHeader returns header along with the User-Agent and Authorization headers g sends to http sources
+func (g *GoGetter) requestHeader(header http.Header) http.Header {
+	h := header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	if g.UserAgent != "" {
+		h.Set("User-Agent", g.UserAgent)
+	}
+	if g.BearerToken != "" && h.Get("Authorization") == "" {
+		h.Set("Authorization", "Bearer "+g.BearerToken)
+	}
+	return h
+}
+
+// cloneGetter returns a shallow copy of g, which is a pointer to a struct like all of go-getter's getters, or g itself otherwise
+func cloneGetter(g getter.Getter) getter.Getter {
+	v := reflect.ValueOf(g)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return g
+	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+
+	if cg, ok := c.Interface().(getter.Getter); ok {
+		return cg
+	}
+	return g
+}
+
+// RegisterGetter makes Fetch use g instead of Getter to download sources of the given scheme,
+// or forced getter, like `httplist` in `httplist::https://...`.
+// Registering a getter for a scheme replaces the one previously registered for it.
+func (r *Remote) RegisterGetter(scheme string, g Getter) {
+	if r.getters == nil {
+		r.getters = map[string]Getter{}
+	}
+	r.getters[scheme] = g
+}
+
+// SupportedScheme tells whether Fetch can download sources of the given scheme, like `https` in `https://...`,
+// or forced getter, like `git` in `git::ssh://...`. It is true for the schemes getters are registered for,
+// and for those go-getter supports out of the box when Getter is a GoGetter.
+func (r *Remote) SupportedScheme(scheme string) bool {
+	if _, ok := r.getters[scheme]; ok {
+		return true
+	}
+
+	if _, ok := r.Getter.(*GoGetter); !ok {
+		return false
+	}
+
+	// gs:// is translated to the URL of go-getter's gcs getter by getterSource
+	if scheme == "gs" {
+		return true
+	}
+
+	_, ok := getter.Getters[scheme]
+	return ok
+}
+
+// Close releases the resources held by the getters that implement io.Closer, like connections they keep open across fetches.
+// The built-in getters connect anew on every fetch, so they hold nothing to release.
+// It also removes the temporary directories Fetch downloaded into in NoCache mode.
+func (r *Remote) Close() error {
+	var err error
+
+	// A getter registered for several schemes is closed once
+	closed := map[io.Closer]bool{}
+	for _, g := range append([]Getter{r.Getter}, r.registeredGetters()...) {
+		c, ok := g.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if reflect.TypeOf(c).Comparable() {
+			if closed[c] {
+				continue
+			}
+			closed[c] = true
+		}
+
+		err = multierr.Append(err, c.Close())
+	}
+
+	r.tempDirsMu.Lock()
+	defer r.tempDirsMu.Unlock()
+
+	for _, dir := range r.tempDirs {
+		err = multierr.Append(err, os.RemoveAll(dir))
+	}
+	r.tempDirs = nil
+
+	return err
+}
+
+// registeredGetters returns the getters registered for schemes, ordered by scheme
+func (r *Remote) registeredGetters() []Getter {
+	schemes := make([]string, 0, len(r.getters))
+	for scheme := range r.getters {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	getters := make([]Getter, 0, len(schemes))
+	for _, scheme := range schemes {
+		getters = append(getters, r.getters[scheme])
+	}
+	return getters
+}
+
+// DisableInsecureFeaturesErr is returned by NewRemote when remote sources are disabled by HELMFILE_DISABLE_INSECURE_FEATURES
+var DisableInsecureFeaturesErr = errors.New("remote sources are disabled due to " + envvar.DisableInsecureFeatures)
+
+func NewRemote(logger *zap.SugaredLogger, homeDir string, fs *filesystem.FileSystem) (*Remote, error) {
+	logger = loggerOrNop(logger)
+
+	allowList := parseAllowList(os.Getenv(envvar.InsecureAllowList))
+
+	// With insecure features disabled, remote sources are accepted only when some are explicitly allowed
+	if disableInsecureFeatures && len(allowList) == 0 {
+		return nil, DisableInsecureFeaturesErr
+	}
+	goGetter := &GoGetter{
+		Logger:      logger,
+		UserAgent:   userAgent(),
+		BearerToken: os.Getenv(envvar.HTTPBearerToken),
+		HTTPTimeout: defaultHTTPTimeout,
+		S3Endpoint:  os.Getenv(envvar.S3Endpoint),
+	}
+	goGetter.S3ForcePathStyle, _ = strconv.ParseBool(os.Getenv(envvar.S3ForcePathStyle))
+
+	remote := &Remote{
+		Logger: logger,
+		Home:   homeDir,
+		Getter: goGetter,
+		fs:     fs,
+	}
+
+	if disableInsecureFeatures {
+		remote.AllowList = allowList
+	}
+
+	remote.AllowedHosts = parseAllowList(os.Getenv(envvar.RemoteAllowedHosts))
+
+	azureBlobGetter := &AzureBlobGetter{Logger: logger}
+	remote.RegisterGetter("az", azureBlobGetter)
+	remote.RegisterGetter("azblob", azureBlobGetter)
+	remote.RegisterGetter("oci", &OCIGetter{Logger: logger})
+	remote.RegisterGetter("sftp", &SFTPGetter{Logger: logger})
+	remote.RegisterGetter(httpListingGetterName, &HTTPListingGetter{
+		Logger:      logger,
+		Listing:     os.Getenv(envvar.RemoteHTTPListing),
+		UserAgent:   userAgent(),
+		BearerToken: os.Getenv(envvar.HTTPBearerToken),
+	})
+
+	if remote.Home == "" {
+		// Use for remote charts
+		remote.Home = CacheDir()
+	}
+
+	remote.Offline, _ = strconv.ParseBool(os.Getenv(envvar.RemoteOffline))
+	remote.ContentAddressed, _ = strconv.ParseBool(os.Getenv(envvar.CacheContentAddressed))
+
+	if dir := os.Getenv(envvar.CacheStoreDir); dir != "" {
+		remote.CacheStore = &FileCacheStore{Dir: dir}
+	}
+	remote.Namespace = os.Getenv(envvar.CacheNamespace)
+	remote.StrictEnvExpansion, _ = strconv.ParseBool(os.Getenv(envvar.RemoteStrictEnv))
+	remote.KeepFailedDownloads, _ = strconv.ParseBool(os.Getenv(envvar.RemoteKeepFailedDownloads))
+
+	if v := os.Getenv(envvar.FetchConcurrency); v != "" {
+		concurrency, err := strconv.Atoi(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.FetchConcurrency, v, err)
+		} else {
+			remote.FetchConcurrency = concurrency
+		}
+	}
+
+	if v := os.Getenv(envvar.FetchRPS); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.FetchRPS, v, err)
+		} else {
+			remote.FetchRPS = rps
+		}
+	}
+
+	if v := os.Getenv(envvar.ConnectRetries); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.ConnectRetries, v, err)
+		} else {
+			remote.ConnectRetries = retries
+		}
+	}
+
+	if v := os.Getenv(envvar.ConnectRetryDelay); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.ConnectRetryDelay, v, err)
+		} else {
+			remote.ConnectRetryDelay = delay
+		}
+	}
+
+	if v := os.Getenv(envvar.FetchTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.FetchTimeout, v, err)
+		} else {
+			remote.Timeout = timeout
+		}
+	}
+
+	if v := os.Getenv(envvar.HTTPTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.HTTPTimeout, v, err)
+		} else {
+			goGetter.HTTPTimeout = timeout
+		}
+	}
+
+	if v := os.Getenv(envvar.CacheMaxAge); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.CacheMaxAge, v, err)
+		} else {
+			remote.CacheMaxAge = maxAge
+		}
+	}
+
+	if v := os.Getenv(envvar.CacheMaxBytes); v != "" {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.CacheMaxBytes, v, err)
+		} else {
+			remote.MaxCacheSize = maxBytes
+		}
+	}
+
+	if v := os.Getenv(envvar.CacheWarnAge); v != "" {
+		warnAge, err := time.ParseDuration(v)
+		if err != nil {
+			logger.Warnf("ignoring invalid %s %q: %v", envvar.CacheWarnAge, v, err)
+		} else {
+			remote.CacheWarnAge = warnAge
+		}
+	}
+
+	return remote, nil
+}
+
+// parseAllowList parses a comma-separated list of schemes and getters, e.g. `https,s3`, or of hosts
+func parseAllowList(v string) []string {
+	var allowList []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allowList = append(allowList, name)
+		}
+	}
+	return allowList
+}
+
+// userAgent returns the User-Agent sent by helmfile to http sources, which can be overridden with HELMFILE_REMOTE_USER_AGENT
+func userAgent() string {
+	if ua := os.Getenv(envvar.RemoteUserAgent); ua != "" {
+		return ua
+	}
+	return "helmfile/" + version.Version()
 }
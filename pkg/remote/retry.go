@@ -0,0 +1,99 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultConnectRetryDelay is how long Fetch waits before retrying a download that failed to connect, when ConnectRetryDelay is zero
+const defaultConnectRetryDelay = time.Second
+
+// connectionErrorMessages are found in the errors of getters that flatten network errors into strings,
+// like go-getter and the git command-line it runs
+var connectionErrorMessages = []string{
+	"no such host",
+	"connection refused",
+	"connection reset",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"network is unreachable",
+	"Could not resolve host",
+	"Failed to connect to",
+}
+
+// isConnectionError tells whether the download failed before the remote could answer, e.g. on a DNS lookup or a refused connection.
+// Those are usually transient, unlike the errors the remote answers with, like RemoteNotFoundError or RemoteAuthError.
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		notFoundErr RemoteNotFoundError
+		authErr     RemoteAuthError
+		serverErr   RemoteServerError
+	)
+	if errors.As(err, &notFoundErr) || errors.As(err, &authErr) || errors.As(err, &serverErr) {
+		return false
+	}
+
+	var (
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+	)
+	if errors.As(err, &dnsErr) || errors.As(err, &opErr) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, m := range connectionErrorMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withConnectRetries returns a download that retries download up to r.ConnectRetries times when it fails to connect,
+// doubling the delay between the attempts each time
+func (r *Remote) withConnectRetries(ctx context.Context, logger *zap.SugaredLogger, src string, download func(dst string) error) func(dst string) error {
+	if r.ConnectRetries <= 0 {
+		return download
+	}
+
+	delay := r.ConnectRetryDelay
+	if delay <= 0 {
+		delay = defaultConnectRetryDelay
+	}
+
+	return func(dst string) error {
+		for attempt := 1; ; attempt++ {
+			err := download(dst)
+			if attempt > r.ConnectRetries || !isConnectionError(err) {
+				return err
+			}
+
+			logger.Warnf("remote> retrying %s in %s (%d/%d) after a connection error: %v", src, delay, attempt, r.ConnectRetries, err)
+
+			// Getters want to create the destination by themselves
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	testcases := []struct {
+		err  error
+		want bool
+	}{
+		{err: &net.DNSError{Err: "no such host", Name: "charts.example.com", IsNotFound: true}, want: true},
+		{err: fmt.Errorf("get: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), want: true},
+		{err: errors.New("error downloading 'https://charts.example.com/values.yaml': Get \"https://charts.example.com/values.yaml\": dial tcp: lookup charts.example.com: no such host"), want: true},
+		{err: errors.New("/usr/bin/git exited with 128: fatal: unable to access 'https://github.com/org/repo.git/': Could not resolve host: github.com"), want: true},
+		{err: RemoteNotFoundError{err: errors.New("bad response code: 404")}, want: false},
+		{err: RemoteServerError{err: errors.New("connection reset by the upstream: bad response code: 502")}, want: false},
+		{err: errors.New("checksum mismatch"), want: false},
+		{err: fmt.Errorf("dial tcp: %w", context.DeadlineExceeded), want: false},
+		{err: nil, want: false},
+	}
+
+	for i, tc := range testcases {
+		if got := isConnectionError(tc.err); got != tc.want {
+			t.Errorf("case %d: isConnectionError(%v): want %v, got %v", i, tc.err, tc.want, got)
+		}
+	}
+}
+
+func TestRemote_ConnectRetries(t *testing.T) {
+	testcases := []struct {
+		retries  int
+		failures []error
+		attempts int
+		err      bool
+	}{
+		{retries: 2, failures: []error{errors.New("lookup github.com: no such host")}, attempts: 2},
+		{retries: 2, failures: []error{errors.New("no such host"), errors.New("connection refused"), errors.New("i/o timeout")}, attempts: 3, err: true},
+		{retries: 2, failures: []error{RemoteNotFoundError{err: errors.New("bad response code: 404")}}, attempts: 1, err: true},
+		{retries: 0, failures: []error{errors.New("no such host")}, attempts: 1, err: true},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(fmt.Sprintf("case %d", i), func(t *testing.T) {
+			var attempts int
+
+			get := func(wd, src, dst string) error {
+				attempts++
+
+				if _, err := os.Stat(dst); !os.IsNotExist(err) {
+					return fmt.Errorf("expected the previous attempt to be cleaned up: %v", err)
+				}
+				if err := os.MkdirAll(dst, 0755); err != nil {
+					return err
+				}
+				if err := os.WriteFile(filepath.Join(dst, "values.yaml"), []byte("foo: bar"), 0644); err != nil {
+					return err
+				}
+
+				if attempts <= len(tc.failures) {
+					return tc.failures[attempts-1]
+				}
+				return nil
+			}
+
+			remote := &Remote{
+				Logger:            helmexec.NewLogger(io.Discard, "debug"),
+				Home:              t.TempDir(),
+				ConnectRetries:    tc.retries,
+				ConnectRetryDelay: time.Millisecond,
+				Getter:            &testGetter{get: get},
+				fs:                filesystem.DefaultFileSystem(),
+			}
+
+			_, err := remote.Fetch("git::https://github.com/helmfile/helmfile.git@values.yaml?ref=main")
+			if tc.err && err == nil {
+				t.Errorf("expected an error")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if attempts != tc.attempts {
+				t.Errorf("unexpected number of attempts: want %d, got %d", tc.attempts, attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-getter"
+)
+
+// s3Getter replaces go-getter's s3 getter, which talks to the host of an S3-compatible store,
+// as in s3::https://minio.internal:9000/bucket/dir, only when the URL holds static credentials, and to AWS otherwise.
+// It talks to endpoint when set, or to the host of the URL when it isn't AWS's, whatever the credentials.
+// Without endpoint, AWS sources are left to fallback, go-getter's own getter.
+type s3Getter struct {
+	// endpoint replaces the host of every s3 source, e.g. https://minio.internal:9000
+	endpoint string
+
+	// forcePathStyle makes the requests to endpoint address the bucket in the path rather than in the host, as MinIO requires
+	forcePathStyle bool
+
+	fallback getter.Getter
+
+	client *getter.Client
+}
+
+func (g *s3Getter) SetClient(c *getter.Client) {
+	g.client = c
+	g.fallback.SetClient(c)
+}
+
+func (g *s3Getter) ClientMode(u *url.URL) (getter.ClientMode, error) {
+	if !g.custom(u) {
+		return g.fallback.ClientMode(u)
+	}
+
+	client, bucket, key, err := g.s3Client(u)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.ListObjectsWithContext(g.context(), &s3.ListObjectsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, o := range resp.Contents {
+		if strings.HasPrefix(aws.StringValue(o.Key), key+"/") {
+			return getter.ClientModeDir, nil
+		}
+	}
+
+	return getter.ClientModeFile, nil
+}
+
+func (g *s3Getter) Get(dst string, u *url.URL) error {
+	if !g.custom(u) {
+		return g.fallback.Get(dst, u)
+	}
+
+	client, bucket, prefix, err := g.s3Client(u)
+	if err != nil {
+		return err
+	}
+
+	ctx := g.context()
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	// List with a trailing slash so that e.g. `dir` doesn't match the objects under `dir-other/`
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+
+	var (
+		found  int
+		getErr error
+	)
+	err = client.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, o := range page.Contents {
+			key := aws.StringValue(o.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+
+			localPath := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(key, prefix)))
+			if checkWithinDir(dst, localPath) != nil || localPath == filepath.Clean(dst) {
+				getErr = fmt.Errorf("object %s/%s would be written outside of %s", bucket, key, dst)
+				return false
+			}
+
+			if getErr = g.getObject(ctx, client, bucket, key, "", localPath); getErr != nil {
+				return false
+			}
+			found++
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("listing %s/%s: %w", bucket, prefix, err)
+	}
+	if getErr != nil {
+		return getErr
+	}
+
+	if found == 0 {
+		return RemoteNotFoundError{err: fmt.Errorf("no objects found under %s/%s", bucket, prefix)}
+	}
+
+	return nil
+}
+
+func (g *s3Getter) GetFile(dst string, u *url.URL) error {
+	if !g.custom(u) {
+		return g.fallback.GetFile(dst, u)
+	}
+
+	client, bucket, key, err := g.s3Client(u)
+	if err != nil {
+		return err
+	}
+
+	return g.getObject(g.context(), client, bucket, key, u.Query().Get("version"), dst)
+}
+
+func (g *s3Getter) getObject(ctx context.Context, client *s3.S3, bucket, key, version, dst string) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if version != "" {
+		input.VersionId = aws.String(version)
+	}
+
+	resp, err := client.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("getting %s/%s: %w", bucket, key, err)
+	}
+
+	body := resp.Body
+	if g.client != nil && g.client.ProgressListener != nil {
+		body = g.client.ProgressListener.TrackProgress(filepath.Base(key), 0, aws.Int64Value(resp.ContentLength), body)
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, body); err != nil {
+		return fmt.Errorf("downloading %s/%s: %w", bucket, key, err)
+	}
+
+	return nil
+}
+
+// custom tells whether u is downloaded from a custom endpoint rather than by the fallback
+func (g *s3Getter) custom(u *url.URL) bool {
+	return g.endpoint != "" || !strings.Contains(u.Host, "amazonaws.com")
+}
+
+func (g *s3Getter) context() context.Context {
+	if g.client == nil || g.client.Ctx == nil {
+		return context.Background()
+	}
+	return g.client.Ctx
+}
+
+// s3Client returns the client of the endpoint of u, along with the bucket and the key u points at.
+// The bucket is the first component of the path, unless the host is AWS's and addresses it, as in <bucket>.s3.<region>.amazonaws.com.
+func (g *s3Getter) s3Client(u *url.URL) (*s3.S3, string, string, error) {
+	q := u.Query()
+
+	conf := &aws.Config{Region: aws.String(q.Get("region"))}
+
+	var bucket, key string
+	if hostParts := strings.Split(u.Host, "."); strings.Contains(u.Host, "amazonaws.com") && len(hostParts) > 3 {
+		bucket, key = hostParts[0], strings.TrimPrefix(u.Path, "/")
+		if aws.StringValue(conf.Region) == "" {
+			conf.Region = aws.String(strings.TrimPrefix(strings.TrimPrefix(hostParts[len(hostParts)-3], "s3-"), "s3"))
+		}
+	} else {
+		bucket, key, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	}
+	if bucket == "" || key == "" {
+		return nil, "", "", fmt.Errorf("invalid s3 url %s: it must be of the form s3::https://<host>/<bucket>/<path>", (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String())
+	}
+	if aws.StringValue(conf.Region) == "" {
+		conf.Region = aws.String("us-east-1")
+	}
+
+	if g.endpoint != "" {
+		conf.Endpoint = aws.String(g.endpoint)
+		conf.S3ForcePathStyle = aws.Bool(g.forcePathStyle)
+	} else {
+		conf.Endpoint = aws.String(u.Host)
+		conf.S3ForcePathStyle = aws.Bool(true)
+		conf.DisableSSL = aws.Bool(u.Scheme == "http")
+	}
+
+	if q.Has("aws_access_key_id") || q.Has("aws_access_key_secret") || q.Has("aws_access_token") {
+		conf.Credentials = credentials.NewStaticCredentials(q.Get("aws_access_key_id"), q.Get("aws_access_key_secret"), q.Get("aws_access_token"))
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *conf,
+		Profile:           q.Get("aws_profile"),
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("creating s3 session: %w", err)
+	}
+
+	return s3.New(sess), bucket, key, nil
+}
@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+// newFakeS3 serves the objects, keyed by `<bucket>/<key>`, with path-style addressing
+func newFakeS3(t *testing.T, objects map[string]string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+		if key == "" {
+			prefix := r.URL.Query().Get("prefix")
+
+			fmt.Fprintf(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>%s</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>`, bucket, prefix)
+			for k, v := range objects {
+				if name := strings.TrimPrefix(k, bucket+"/"); name != k && strings.HasPrefix(name, prefix) {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, name, len(v))
+				}
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+
+		content, ok := objects[bucket+"/"+key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code></Error>`)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestGoGetter_S3Endpoint(t *testing.T) {
+	// Credentials that don't require any lookup, and no source has any of its own
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	srv := newFakeS3(t, map[string]string{
+		"bucket/charts/values.yaml":      "foo: bar",
+		"bucket/charts/envs/prod.yaml":   "env: prod",
+		"bucket/charts-other/other.yaml": "other: true",
+	})
+
+	logger := helmexec.NewLogger(io.Discard, "debug")
+
+	testcases := map[string]struct {
+		getter *GoGetter
+		src    string
+	}{
+		"host of the url": {
+			getter: &GoGetter{Logger: logger},
+			src:    "s3::" + srv.URL + "/bucket/charts@values.yaml",
+		},
+		"endpoint override": {
+			getter: &GoGetter{Logger: logger, S3Endpoint: srv.URL, S3ForcePathStyle: true},
+			src:    "s3::https://s3.amazonaws.com/bucket/charts@values.yaml",
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			remote := &Remote{
+				Logger: logger,
+				Home:   t.TempDir(),
+				Getter: tc.getter,
+				fs:     filesystem.DefaultFileSystem(),
+			}
+
+			file, err := remote.Fetch(tc.src)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if bs, err := os.ReadFile(file); err != nil || string(bs) != "foo: bar" {
+				t.Errorf("unexpected content of %s: %q, %v", file, string(bs), err)
+			}
+			if bs, err := os.ReadFile(filepath.Join(filepath.Dir(file), "envs", "prod.yaml")); err != nil || string(bs) != "env: prod" {
+				t.Errorf("expected every object under the prefix to be downloaded: %q, %v", string(bs), err)
+			}
+			entries, err := os.ReadDir(filepath.Dir(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if diff := cmp.Diff([]string{"envs", "values.yaml"}, names); diff != "" {
+				t.Errorf("expected only the objects under the prefix to be downloaded:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-getter/helper/url"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPGetter downloads a remote directory over SFTP.
+// The source must be of the form sftp://<user>@<host>[:<port>]/<path/to/dir>.
+// Like go-getter's git getter, it authenticates with the base64-encoded private key in the `sshkey` query parameter,
+// or with the keys held by ssh-agent otherwise. The host key is verified against ~/.ssh/known_hosts.
+type SFTPGetter struct {
+	Logger *zap.SugaredLogger
+}
+
+func (g *SFTPGetter) Get(ctx context.Context, wd, src, dst string) error {
+	u, err := url.Parse(src)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+
+	if u.Scheme != "sftp" {
+		return fmt.Errorf("unsupported sftp scheme %q: it must be sftp", u.Scheme)
+	}
+
+	if u.User == nil || u.User.Username() == "" {
+		return fmt.Errorf("invalid sftp url: it must be `sftp://<user>@<host>/<path/to/dir>`: missing user")
+	}
+
+	auth, closeAuth, err := sftpAuthMethod(u.Query().Get("sshkey"))
+	if err != nil {
+		return err
+	}
+	defer closeAuth()
+
+	hostKeyCallback, err := sftpHostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	defer netConn.Close()
+
+	// Closing the connection aborts the handshake or any transfer in progress
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			netConn.Close()
+		case <-done:
+		}
+	}()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, &ssh.ClientConfig{
+		User:            u.User.Username(),
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return RemoteAuthError{err: fmt.Errorf("connecting to %s: %w", addr, err)}
+		}
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	conn := ssh.NewClient(sshConn, chans, reqs)
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("starting sftp session with %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	root := u.Path
+
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			switch {
+			case os.IsNotExist(err):
+				return RemoteNotFoundError{err: fmt.Errorf("walking %s: %w", root, err)}
+			case os.IsPermission(err):
+				return RemoteAuthError{err: fmt.Errorf("walking %s: %w", root, err)}
+			}
+			return fmt.Errorf("walking %s: %w", root, err)
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		localPath := filepath.Join(dst, filepath.FromSlash(rel))
+
+		if walker.Stat().IsDir() {
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !walker.Stat().Mode().IsRegular() {
+			loggerOrNop(g.Logger).Debugf("sftp> skipping %s: not a regular file", walker.Path())
+			continue
+		}
+
+		loggerOrNop(g.Logger).Debugf("sftp> downloading %s to %s", walker.Path(), localPath)
+
+		if err := downloadSFTPFile(client, walker.Path(), localPath); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func downloadSFTPFile(client *sftp.Client, remotePath, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+
+	r, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", remotePath, err)
+	}
+	defer r.Close()
+
+	w, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("downloading %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+// sftpAuthMethod returns the method to authenticate with, along with a function that releases what it holds
+func sftpAuthMethod(sshkey string) (ssh.AuthMethod, func(), error) {
+	if sshkey != "" {
+		key, err := base64.StdEncoding.DecodeString(sshkey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding sshkey: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing sshkey: %w", err)
+		}
+
+		return ssh.PublicKeys(signer), func() {}, nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, fmt.Errorf("no ssh credentials: either set the sshkey query parameter or run ssh-agent")
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to ssh-agent: %w", err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), func() { conn.Close() }, nil
+}
+
+func sftpHostKeyCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	cb, err := knownhosts.New(path.Join(filepath.ToSlash(home), ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %w", err)
+	}
+
+	return cb, nil
+}
@@ -0,0 +1,175 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/helmfile/helmfile/pkg/helmexec"
+	"github.com/helmfile/helmfile/pkg/testhelper"
+)
+
+func TestSFTPGetter_InvalidSource(t *testing.T) {
+	type testcase struct {
+		src, err string
+	}
+
+	testcases := []testcase{
+		{
+			src: "sftp://example.com/charts",
+			err: "invalid sftp url: it must be `sftp://<user>@<host>/<path/to/dir>`: missing user",
+		},
+		{
+			src: "ftp://user@example.com/charts",
+			err: `unsupported sftp scheme "ftp": it must be sftp`,
+		},
+		{
+			src: "sftp://user@example.com/charts?sshkey=!!!",
+			err: "decoding sshkey: illegal base64 data at input byte 0",
+		},
+	}
+
+	for i := range testcases {
+		tc := testcases[i]
+
+		t.Run(fmt.Sprintf("case %d", i), func(t *testing.T) {
+			g := &SFTPGetter{Logger: helmexec.NewLogger(io.Discard, "debug")}
+
+			err := g.Get(context.Background(), "", tc.src, t.TempDir())
+
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+
+			if diff := cmp.Diff(tc.err, errMsg); diff != "" {
+				t.Fatalf("Unexpected error:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSFTPGetter_CancelledHandshake(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", home)
+
+	// A server that accepts connections but never starts the ssh handshake
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	sockDir, err := os.MkdirTemp("", "helmfile-agent-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(sockDir)
+
+	sock := filepath.Join(sockDir, "agent.sock")
+	agentListener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agentListener.Close()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	agentDone := make(chan struct{})
+	go func() {
+		defer close(agentDone)
+		conn, err := agentListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = agent.ServeAgent(agent.NewKeyring(), conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	g := &SFTPGetter{Logger: helmexec.NewLogger(io.Discard, "debug")}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- g.Get(ctx, "", "sftp://user@"+server.Addr().String()+"/charts", t.TempDir())
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the handshake to be interrupted by the context, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handshake wasn't interrupted by the context")
+	}
+
+	select {
+	case <-agentDone:
+	case <-time.After(5 * time.Second):
+		t.Error("expected the connection to ssh-agent to be closed")
+	}
+}
+
+func TestRemote_SFTP(t *testing.T) {
+	testfs := testhelper.NewTestFs(map[string]string{
+		CacheDir(): "",
+	})
+
+	get := func(wd, src, dst string) error {
+		return fmt.Errorf("unexpected call to go-getter with src: %s", src)
+	}
+
+	var downloaded string
+	sftpGet := func(wd, src, dst string) error {
+		downloaded = src
+		return nil
+	}
+
+	remote := &Remote{
+		Logger: helmexec.NewLogger(io.Discard, "debug"),
+		Home:   CacheDir(),
+		Getter: &testGetter{get: get},
+		fs:     testfs.ToFileSystem(),
+	}
+
+	remote.RegisterGetter("sftp", &testGetter{get: sftpGet})
+
+	file, err := remote.Fetch("sftp://user@example.com:2222/charts@values.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if downloaded != "sftp://user@example.com:2222/charts" {
+		t.Errorf("unexpected src: %s", downloaded)
+	}
+
+	expectedFile := filepath.Join(CacheDir(), "sftp_example_com2222_charts-fb81736236c2/values.yaml")
+	if file != expectedFile {
+		t.Errorf("unexpected file located: %s vs expected: %s", file, expectedFile)
+	}
+}
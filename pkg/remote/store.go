@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CacheStore is a cache of remote directories shared beyond the local cache under the remote's Home,
+// e.g. by the ephemeral workers of a serverless environment.
+// Fetch gets a directory missing from the local cache from the store before downloading it,
+// and puts the directories it downloads into the store.
+// Keys are the slash-separated cache keys of the directories, as in FetchResult.CacheKey.
+type CacheStore interface {
+	// Get returns the path of a local directory holding the files stored under key, if any.
+	// Fetch only reads the directory.
+	Get(key string) (string, bool)
+
+	// Put stores the files of the local directory srcDir under key, replacing those stored before
+	Put(key, srcDir string) error
+
+	// Exists tells whether files are stored under key
+	Exists(key string) bool
+}
+
+// FileCacheStore is a CacheStore keeping the directories under Dir, which can be a volume shared across machines
+type FileCacheStore struct {
+	Dir string
+}
+
+func (s *FileCacheStore) path(key string) (string, error) {
+	p := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := checkWithinDir(s.Dir, p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func (s *FileCacheStore) Get(key string) (string, bool) {
+	if !s.Exists(key) {
+		return "", false
+	}
+
+	p, _ := s.path(key)
+	return p, true
+}
+
+// Put copies srcDir next to where it is stored and renames it into place, so that readers never see a partial directory
+func (s *FileCacheStore) Put(key, srcDir string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(p), filepath.Base(p)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpDst := filepath.Join(tmpDir, "src")
+	if err := copyDir(srcDir, tmpDst); err != nil {
+		return fmt.Errorf("copying %s into the cache store: %w", srcDir, err)
+	}
+
+	if err := os.RemoveAll(p); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpDst, p)
+}
+
+func (s *FileCacheStore) Exists(key string) bool {
+	p, err := s.path(key)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// copyDir copies the files, directories and symlinks under src to dst, which must not exist.
+// src itself may be a symlink, like the entries of a content-addressed cache.
+func copyDir(src, dst string) error {
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/helmfile/helmfile/pkg/filesystem"
+	"github.com/helmfile/helmfile/pkg/helmexec"
+)
+
+func TestRemote_CacheStore(t *testing.T) {
+	store := &FileCacheStore{Dir: t.TempDir()}
+
+	var downloads int
+
+	get := func(wd, src, dst string) error {
+		downloads++
+		if err := os.MkdirAll(filepath.Join(dst, "nested"), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, "nested", "values.yaml"), []byte("foo: bar"), 0644)
+	}
+
+	newRemote := func(offline bool) *Remote {
+		return &Remote{
+			Logger:     helmexec.NewLogger(io.Discard, "debug"),
+			Home:       t.TempDir(),
+			Offline:    offline,
+			CacheStore: store,
+			Getter:     &testGetter{get: get},
+			fs:         filesystem.DefaultFileSystem(),
+		}
+	}
+
+	src := "git::https://github.com/helmfile/helmfile.git@nested/values.yaml?ref=main"
+
+	// The first worker downloads the directory and puts it into the store.
+	// The next ones, with empty local caches, get it from the store, even offline.
+	for i, offline := range []bool{false, false, true} {
+		file, err := newRemote(offline).Fetch(src)
+		if err != nil {
+			t.Fatalf("worker %d: unexpected error: %v", i, err)
+		}
+
+		if bs, err := os.ReadFile(file); err != nil || string(bs) != "foo: bar" {
+			t.Errorf("worker %d: unexpected content of %s: %q, %v", i, file, string(bs), err)
+		}
+	}
+
+	if downloads != 1 {
+		t.Errorf("expected the directory to be downloaded once, got %d downloads", downloads)
+	}
+
+	r := newRemote(false)
+	plan, err := r.Plan(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.Exists(plan.CacheKey) {
+		t.Errorf("expected %s to be in the store", plan.CacheKey)
+	}
+
+	// A forced refresh downloads the directory again and refreshes the store
+	r.ForceRefresh = true
+	if _, err := r.Fetch(src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if downloads != 2 {
+		t.Errorf("expected a forced refresh to download the directory, got %d downloads", downloads)
+	}
+}
+
+func TestFileCacheStore_OutsideOfDir(t *testing.T) {
+	store := &FileCacheStore{Dir: t.TempDir()}
+
+	if err := store.Put("../escaped", t.TempDir()); err == nil {
+		t.Errorf("expected an error for a key outside of the store")
+	}
+	if store.Exists("../") {
+		t.Errorf("expected a key outside of the store not to exist")
+	}
+}
@@ -82,7 +82,8 @@ func (testEnv stateTestEnv) MustLoadStateWithEnableLiveOutput(t *testing.T, file
 		t.Fatalf("no file named %q registered", file)
 	}
 
-	r := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	r, err := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	require.NoError(t, err)
 	state, err := NewCreator(logger, testFs.ToFileSystem(), nil, nil, "", r, enableLiveOutput, "").
 		ParseAndLoad([]byte(yamlContent), filepath.Dir(file), file, envName, true, nil, nil)
 	if err != nil {
@@ -149,7 +150,8 @@ releaseNamespace: mynamespace
 	})
 	testFs.Cwd = "/example/path/to"
 
-	r := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	r, err := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	require.NoError(t, err)
 	env := environment.Environment{
 		Name: "production",
 	}
@@ -239,7 +241,8 @@ overrideNamespace: myns
 	})
 	testFs.Cwd = "/example/path/to"
 
-	r := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	r, err := remote.NewRemote(logger, testFs.Cwd, testFs.ToFileSystem())
+	require.NoError(t, err)
 	state, err := NewCreator(logger, testFs.ToFileSystem(), nil, nil, "", r, false, "").
 		ParseAndLoad(yamlContent, filepath.Dir(yamlFile), yamlFile, "production", true, nil, nil)
 	if err != nil {
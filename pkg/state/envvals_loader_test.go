@@ -22,7 +22,12 @@ func newLoader() *EnvironmentValuesLoader {
 		logger:   log,
 	}
 
-	return NewEnvironmentValuesLoader(storage, storage.fs, log, remote.NewRemote(log, "/tmp", storage.fs))
+	r, err := remote.NewRemote(log, "/tmp", storage.fs)
+	if err != nil {
+		panic(err)
+	}
+
+	return NewEnvironmentValuesLoader(storage, storage.fs, log, r)
 }
 
 // See https://github.com/roboll/helmfile/pull/1169
@@ -73,7 +73,10 @@ func (st *HelmState) goGetterChart(chart, dir, cacheDir string, force bool) (str
 			return "", fmt.Errorf("Parsing url from dir failed due to error %q.\nContinuing the process assuming this is a regular Helm chart or a local dir.", err.Error())
 		}
 	} else {
-		r := remote.NewRemote(st.logger, "", st.fs)
+		r, err := remote.NewRemote(st.logger, "", st.fs)
+		if err != nil {
+			return "", err
+		}
 
 		fetchedDir, err := r.Fetch(chart, cacheDir)
 		if err != nil {
@@ -57,9 +57,14 @@ func (st *Storage) resolveFile(missingFileHandler *string, tpe, path string, opt
 	}
 
 	if remote.IsRemote(path) {
-		r := remote.NewRemote(st.logger, "", st.fs)
+		r, err := remote.NewRemote(st.logger, "", st.fs)
+		if err != nil {
+			return nil, false, err
+		}
 
-		fetchedFilePath, err := r.Fetch(path, "values")
+		// The file part of the source may be a glob, e.g. s3::https://s3.amazonaws.com/bucket/dir@*.yaml,
+		// matched against the fetched directory
+		matches, err := r.FetchMatches(path, "values")
 		if err != nil {
 			// https://github.com/helmfile/helmfile/issues/392
 			if conf.IgnoreMissingGitBranch && strings.Contains(err.Error(), "' did not match any file(s) known to git") {
@@ -69,9 +74,7 @@ func (st *Storage) resolveFile(missingFileHandler *string, tpe, path string, opt
 			}
 		}
 
-		if st.fs.FileExistsAt(fetchedFilePath) {
-			files = []string{fetchedFilePath}
-		}
+		files = matches
 	} else {
 		files, err = st.ExpandPaths(path)
 	}
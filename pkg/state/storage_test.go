@@ -3,6 +3,8 @@ package state
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -107,7 +109,7 @@ func TestStorage_resolveFile(t *testing.T) {
 				title:              "values",
 				missingFileHandler: &infoHandler,
 			},
-			wantFiles:   []string{fmt.Sprintf("%s/%s", cacheDir, "values/https_github_com_helmfile_helmfile_git.ref=v0.145.2/examples/values/replica-values.yaml")},
+			wantFiles:   []string{fmt.Sprintf("%s/%s", cacheDir, "values/https_github_com_helmfile_helmfile_git.ref=v0.145.2-cb6ffb54cbb3/examples/values/replica-values.yaml")},
 			wantSkipped: false,
 			wantErr:     false,
 		},
@@ -140,3 +142,52 @@ func TestStorage_resolveFile(t *testing.T) {
 		})
 	}
 }
+
+func TestStorage_resolveFile_RemoteGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.yaml", "b.yaml", "c.json", "ab.yaml", "nested/d.yaml", "nested/deeper/e.yaml"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("foo: bar"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern   string
+		wantFiles []string
+	}{
+		{pattern: "*.yaml", wantFiles: []string{"a.yaml", "ab.yaml", "b.yaml"}},
+		// `?` starts the query of a URL, so it has to be escaped
+		{pattern: "%3F.yaml", wantFiles: []string{"a.yaml", "b.yaml"}},
+		{pattern: "nested/*.yaml", wantFiles: []string{"nested/d.yaml"}},
+		{pattern: "nested/*/*.yaml", wantFiles: []string{"nested/deeper/e.yaml"}},
+		{pattern: "*", wantFiles: []string{"a.yaml", "ab.yaml", "b.yaml", "c.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			st := NewStorage(dir, helmexec.NewLogger(io.Discard, "debug"), filesystem.DefaultFileSystem())
+
+			path := fmt.Sprintf("file://%s@%s", filepath.ToSlash(dir), tt.pattern)
+
+			files, skipped, err := st.resolveFile(nil, "values", path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if skipped {
+				t.Errorf("unexpected skip")
+			}
+
+			var wantFiles []string
+			for _, f := range tt.wantFiles {
+				wantFiles = append(wantFiles, filepath.Join(dir, f))
+			}
+			if !reflect.DeepEqual(files, wantFiles) {
+				t.Errorf("resolveFile() files = %v, want %v", files, wantFiles)
+			}
+		})
+	}
+}